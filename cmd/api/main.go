@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
 	_ "github.com/lib/pq"
@@ -14,6 +15,7 @@ import (
 	"order_food_online/internal/repository"
 	"order_food_online/internal/server"
 	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
 	"os"
 )
 
@@ -50,6 +52,35 @@ func provideDependencies(container *dig.Container) error {
 		return err
 	}
 
+	// Provide the bearer token verifier
+	if err := container.Provide(func() (*auth.Verifier, error) {
+		return auth.NewVerifier(auth.Config{
+			HMACSecret: []byte(os.Getenv("JWT_SECRET")),
+			JWKSFile:   os.Getenv("JWT_JWKS_FILE"),
+			Issuer:     os.Getenv("JWT_ISSUER"),
+			Audience:   os.Getenv("JWT_AUDIENCE"),
+		})
+	}); err != nil {
+		return err
+	}
+
+	// Provide the issuer of customer tokens. Deployments that only accept the tokens of an
+	// external issuer set no JWT_SECRET: they get no issuer, and customers can't log in.
+	if err := container.Provide(func(logger *slog.Logger) (*auth.TokenIssuer, error) {
+		issuer, err := auth.NewTokenIssuer(auth.Config{
+			HMACSecret: []byte(os.Getenv("JWT_SECRET")),
+			Issuer:     os.Getenv("JWT_ISSUER"),
+			Audience:   os.Getenv("JWT_AUDIENCE"),
+		}, config.AccessTokenTTL())
+		if errors.Is(err, auth.ErrNoSigningKey) {
+			logger.Warn("JWT_SECRET is not set: customer accounts are disabled")
+			return nil, nil
+		}
+		return issuer, err
+	}); err != nil {
+		return err
+	}
+
 	// Provide cache
 	if err := container.Provide(cache.NewProductCache); err != nil {
 		return err
@@ -60,6 +91,9 @@ func provideDependencies(container *dig.Container) error {
 	if err := container.Provide(cache.NewPromoCodeCache); err != nil {
 		return err
 	}
+	if err := container.Provide(cache.NewCartCache); err != nil {
+		return err
+	}
 
 	// Provide repositories
 	if err := container.Provide(repository.NewProductRepository); err != nil {
@@ -68,8 +102,34 @@ func provideDependencies(container *dig.Container) error {
 	if err := container.Provide(repository.NewOrderRepository); err != nil {
 		return err
 	}
+	if err := container.Provide(repository.NewPromoCodeRepository); err != nil {
+		return err
+	}
+	if err := container.Provide(repository.NewExchangeRateRepository); err != nil {
+		return err
+	}
+	if err := container.Provide(repository.NewTaxRuleRepository); err != nil {
+		return err
+	}
+	if err := container.Provide(repository.NewUserRepository); err != nil {
+		return err
+	}
+	if err := container.Provide(repository.NewRefreshTokenRepository); err != nil {
+		return err
+	}
+	if err := container.Provide(repository.NewAPIKeyRepository); err != nil {
+		return err
+	}
+	if err := container.Provide(func() (repository.CouponRepository, error) {
+		return repository.NewCouponRepository(os.Getenv("COUPON_DIR"))
+	}); err != nil {
+		return err
+	}
 
 	// Provide services
+	if err := container.Provide(services.NewCurrencyService); err != nil {
+		return err
+	}
 	if err := container.Provide(services.NewProductService); err != nil {
 		return err
 	}
@@ -79,6 +139,18 @@ func provideDependencies(container *dig.Container) error {
 	if err := container.Provide(services.NewPromoCodeService); err != nil {
 		return err
 	}
+	if err := container.Provide(services.NewTaxService); err != nil {
+		return err
+	}
+	if err := container.Provide(services.NewAuthService); err != nil {
+		return err
+	}
+	if err := container.Provide(services.NewAPIKeyService); err != nil {
+		return err
+	}
+	if err := container.Provide(services.NewCartService); err != nil {
+		return err
+	}
 
 	// Provide handlers
 	if err := container.Provide(handlers.NewProductHandler); err != nil {
@@ -87,6 +159,24 @@ func provideDependencies(container *dig.Container) error {
 	if err := container.Provide(handlers.NewOrderHandler); err != nil {
 		return err
 	}
+	if err := container.Provide(handlers.NewPromoCodeHandler); err != nil {
+		return err
+	}
+	if err := container.Provide(handlers.NewCurrencyHandler); err != nil {
+		return err
+	}
+	if err := container.Provide(handlers.NewTaxHandler); err != nil {
+		return err
+	}
+	if err := container.Provide(handlers.NewAuthHandler); err != nil {
+		return err
+	}
+	if err := container.Provide(handlers.NewAPIKeyHandler); err != nil {
+		return err
+	}
+	if err := container.Provide(handlers.NewCartHandler); err != nil {
+		return err
+	}
 
 	// Provide the Echo instance
 	if err := container.Provide(func() *echo.Echo {
@@ -1,6 +1,15 @@
 package config
 
-import "github.com/joho/godotenv"
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// defaultCancellationWindow is how long customers may cancel an order the kitchen has accepted
+const defaultCancellationWindow = 5 * time.Minute
 
 func LoadEnv() error {
 	if err := godotenv.Load(); err != nil {
@@ -8,3 +17,90 @@ func LoadEnv() error {
 	}
 	return nil
 }
+
+// CancellationWindow reads ORDER_CANCELLATION_WINDOW, a duration such as "5m",
+// falling back to the default when it is unset or invalid.
+func CancellationWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("ORDER_CANCELLATION_WINDOW"))
+	if err != nil || window < 0 {
+		return defaultCancellationWindow
+	}
+	return window
+}
+
+// defaultBaseCurrency is the currency catalog prices are kept in
+const defaultBaseCurrency = "USD"
+
+// BaseCurrency reads BASE_CURRENCY, the ISO 4217 code of the catalog's prices,
+// falling back to the default when it is unset.
+func BaseCurrency() string {
+	if currency := strings.ToUpper(strings.TrimSpace(os.Getenv("BASE_CURRENCY"))); currency != "" {
+		return currency
+	}
+	return defaultBaseCurrency
+}
+
+// defaultPublicRoutes can be reached without a bearer token when AUTH_PUBLIC_ROUTES is unset
+var defaultPublicRoutes = []string{
+	"GET /products",
+	"GET /products/:id",
+	"GET /exchange-rates",
+	"GET /tax-rules",
+	"GET /coupons/status",
+}
+
+// PublicRoutes reads AUTH_PUBLIC_ROUTES, a comma separated list of routes reachable without a
+// bearer token, such as "GET /products,GET /products/:id". /health, the routes customers
+// authenticate with and the cart routes other than checkout are always public.
+func PublicRoutes() []string {
+	routes := defaultPublicRoutes
+	if value, ok := os.LookupEnv("AUTH_PUBLIC_ROUTES"); ok {
+		routes = strings.Split(value, ",")
+	}
+	return append([]string{
+		"/health", "POST /auth/register", "POST /auth/login", "POST /auth/refresh", "POST /auth/logout",
+		"GET /cart", "/cart/items", "/cart/items/:product_id", "/cart/coupon",
+	}, routes...)
+}
+
+// Lifetimes of the tokens issued when customers log in
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// AccessTokenTTL reads ACCESS_TOKEN_TTL, how long issued bearer tokens are valid,
+// falling back to the default when it is unset or invalid.
+func AccessTokenTTL() time.Duration {
+	return positiveDuration("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL reads REFRESH_TOKEN_TTL, how long a refresh token may be exchanged
+// for new tokens, falling back to the default when it is unset or invalid.
+func RefreshTokenTTL() time.Duration {
+	return positiveDuration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+}
+
+// positiveDuration reads a duration such as "15m" from the environment variable key.
+func positiveDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// defaultCartTTL is how long a cart is kept after it last changed
+const defaultCartTTL = 7 * 24 * time.Hour
+
+// CartTTL reads CART_TTL, how long a shopping cart is kept after it last changed,
+// falling back to the default when it is unset or invalid.
+func CartTTL() time.Duration {
+	return positiveDuration("CART_TTL", defaultCartTTL)
+}
+
+// BootstrapAdminEmail reads BOOTSTRAP_ADMIN_EMAIL, the email of the account that becomes a
+// platform admin when it logs in while there is none yet. Empty when unset.
+func BootstrapAdminEmail() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("BOOTSTRAP_ADMIN_EMAIL")))
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"order_food_online/internal/models"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrCartConflict is returned when a cart keeps being changed by other requests while
+	// it is updated
+	ErrCartConflict = errors.New("cart was changed by another request")
+	// ErrCartChanged is returned when a cart is not deleted because it changed since the
+	// revision it was to be deleted at
+	ErrCartChanged = errors.New("cart changed since it was read")
+)
+
+// maxCartRetries bounds how many times a change is tried again when the cart changed under it
+const maxCartRetries = 5
+
+// CartCache stores shopping carts. Unlike the other caches, it is where carts live:
+// a cart that expires is gone.
+//
+// Carts are changed with optimistic transactions: a change made while another request
+// changed the cart is tried again on the new content, so concurrent changes are not lost.
+type CartCache interface {
+	GetCart(models.CartOwner) (*models.Cart, error)
+	// UpdateCart applies a change to the cart of the owner, an empty cart when there is none,
+	// and stores it for ttl. Errors of the change are returned as is and leave the cart alone.
+	UpdateCart(owner models.CartOwner, ttl time.Duration, change func(*models.Cart) error) (*models.Cart, error)
+	// MergeCart merges the cart of from into the one of into and deletes it, in a single
+	// transaction. Nothing happens when from has no cart.
+	MergeCart(from, into models.CartOwner, ttl time.Duration, merge func(into, from *models.Cart) error) error
+	// DeleteCart deletes the cart of the owner, provided it is still at the given revision.
+	DeleteCart(owner models.CartOwner, revision string) error
+}
+
+type redisCartCache struct {
+	client *redis.Client
+}
+
+func NewCartCache(client *redis.Client) CartCache {
+	return &redisCartCache{client: client}
+}
+
+// GetCart returns the cart of the owner, or nil when there is none.
+func (c *redisCartCache) GetCart(owner models.CartOwner) (*models.Cart, error) {
+	return readCart(context.Background(), c.client, buildCartKey(owner))
+}
+
+func (c *redisCartCache) UpdateCart(owner models.CartOwner, ttl time.Duration, change func(*models.Cart) error) (*models.Cart, error) {
+	ctx := context.Background()
+	key := buildCartKey(owner)
+
+	var updated *models.Cart
+	err := c.watch(ctx, func(tx *redis.Tx) error {
+		cart, err := readCart(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if cart == nil {
+			cart = &models.Cart{Items: []models.CartItem{}}
+		}
+		if err := change(cart); err != nil {
+			return err
+		}
+		data, err := json.Marshal(cart)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return pipe.Set(ctx, key, data, ttl).Err()
+		})
+		updated = cart
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (c *redisCartCache) MergeCart(from, into models.CartOwner, ttl time.Duration, merge func(into, from *models.Cart) error) error {
+	ctx := context.Background()
+	fromKey, intoKey := buildCartKey(from), buildCartKey(into)
+
+	return c.watch(ctx, func(tx *redis.Tx) error {
+		source, err := readCart(ctx, tx, fromKey)
+		if err != nil || source == nil {
+			return err
+		}
+		target, err := readCart(ctx, tx, intoKey)
+		if err != nil {
+			return err
+		}
+		if target == nil {
+			target = &models.Cart{Items: []models.CartItem{}}
+		}
+		if err := merge(target, source); err != nil {
+			return err
+		}
+		data, err := json.Marshal(target)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, intoKey, data, ttl)
+			pipe.Del(ctx, fromKey)
+			return nil
+		})
+		return err
+	}, fromKey, intoKey)
+}
+
+func (c *redisCartCache) DeleteCart(owner models.CartOwner, revision string) error {
+	ctx := context.Background()
+	key := buildCartKey(owner)
+
+	return c.watch(ctx, func(tx *redis.Tx) error {
+		cart, err := readCart(ctx, tx, key)
+		if err != nil || cart == nil {
+			return err
+		}
+		if cart.Revision != revision {
+			return ErrCartChanged
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return pipe.Del(ctx, key).Err()
+		})
+		return err
+	}, key)
+}
+
+// watch runs fn in an optimistic transaction on the keys, trying again while they are
+// changed by other clients before the transaction commits.
+func (c *redisCartCache) watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxCartRetries; i++ {
+		err := c.client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return ErrCartConflict
+}
+
+// readCart returns the cart stored under key, or nil when there is none.
+func readCart(ctx context.Context, client redis.Cmdable, key string) (*models.Cart, error) {
+	data, err := client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cart models.Cart
+	if err := json.Unmarshal([]byte(data), &cart); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func buildCartKey(owner models.CartOwner) string {
+	return "Cart:" + owner.Key()
+}
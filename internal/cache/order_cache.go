@@ -2,7 +2,10 @@ package cache
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"order_food_online/internal/models"
 	"strconv"
 	"time"
@@ -11,10 +14,13 @@ import (
 )
 
 type OrderCache interface {
-	GetAllOrders() ([]models.Order, error)
-	SetAllOrders([]models.Order, time.Duration) error
 	GetOrderByID(int) (*models.Order, error)
 	SetOrderByID(int, *models.Order, time.Duration) error
+	GetIdempotencyRecord(string) (*models.IdempotencyRecord, error)
+	SetIdempotencyRecord(string, *models.IdempotencyRecord, time.Duration) error
+	GetCustomerOrderPage(models.OrderQuery) (*models.OrderPage, error)
+	SetCustomerOrderPage(models.OrderQuery, *models.OrderPage, time.Duration) error
+	InvalidateCustomerOrderPages(customerID int) error
 }
 
 type redisOrderCache struct {
@@ -25,48 +31,124 @@ func NewOrderCache(client *redis.Client) OrderCache {
 	return &redisOrderCache{client: client}
 }
 
-func (c *redisOrderCache) GetAllOrders() ([]models.Order, error) {
-	data, err := c.client.Get(context.Background(), "Orders").Result()
+func (c *redisOrderCache) GetOrderByID(id int) (*models.Order, error) {
+	data, err := c.client.Get(context.Background(), buildOrderKey(id)).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	var Orders []models.Order
-	if err := json.Unmarshal([]byte(data), &Orders); err != nil {
+	var Order models.Order
+	if err := json.Unmarshal([]byte(data), &Order); err != nil {
 		return nil, err
 	}
-	return Orders, nil
+	return &Order, nil
 }
 
-func (c *redisOrderCache) SetAllOrders(Orders []models.Order, ttl time.Duration) error {
-	data, err := json.Marshal(Orders)
+func (c *redisOrderCache) SetOrderByID(id int, Order *models.Order, ttl time.Duration) error {
+	data, err := json.Marshal(Order)
 	if err != nil {
 		return err
 	}
-	return c.client.Set(context.Background(), "Orders", data, ttl).Err()
+	return c.client.Set(context.Background(), buildOrderKey(id), data, ttl).Err()
 }
 
-func (c *redisOrderCache) GetOrderByID(id int) (*models.Order, error) {
-	data, err := c.client.Get(context.Background(), buildOrderKey(id)).Result()
+func (c *redisOrderCache) GetIdempotencyRecord(key string) (*models.IdempotencyRecord, error) {
+	data, err := c.client.Get(context.Background(), buildIdempotencyKey(key)).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	var Order models.Order
-	if err := json.Unmarshal([]byte(data), &Order); err != nil {
+	var record models.IdempotencyRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
 		return nil, err
 	}
-	return &Order, nil
+	return &record, nil
 }
 
-func (c *redisOrderCache) SetOrderByID(id int, Order *models.Order, ttl time.Duration) error {
-	data, err := json.Marshal(Order)
+func (c *redisOrderCache) SetIdempotencyRecord(key string, record *models.IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
-	return c.client.Set(context.Background(), buildOrderKey(id), data, ttl).Err()
+	return c.client.Set(context.Background(), buildIdempotencyKey(key), data, ttl).Err()
+}
+
+// GetCustomerOrderPage reads a page of the orders of query.CustomerID.
+func (c *redisOrderCache) GetCustomerOrderPage(query models.OrderQuery) (*models.OrderPage, error) {
+	key, err := c.buildCustomerOrderPageKey(query)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.client.Get(context.Background(), key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var page models.OrderPage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// SetCustomerOrderPage stores a page of the orders of query.CustomerID.
+func (c *redisOrderCache) SetCustomerOrderPage(query models.OrderQuery, page *models.OrderPage, ttl time.Duration) error {
+	key, err := c.buildCustomerOrderPageKey(query)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(context.Background(), key, data, ttl).Err()
+}
+
+// InvalidateCustomerOrderPages drops every cached page of a customer's orders.
+func (c *redisOrderCache) InvalidateCustomerOrderPages(customerID int) error {
+	ctx := context.Background()
+	key := buildCustomerOrdersVersionKey(customerID)
+	if err := c.client.Incr(ctx, key).Err(); err != nil {
+		return err
+	}
+	return c.client.Expire(ctx, key, customerOrdersVersionTTL).Err()
+}
+
+// customerOrdersVersionTTL outlives cached pages by far, so a version never expires
+// while pages of an older version are still cached
+const customerOrdersVersionTTL = 24 * time.Hour
+
+// buildCustomerOrderPageKey derives a key from the customer, the current version of their pages
+// and the query shape. Pages of different customers never share a key.
+func (c *redisOrderCache) buildCustomerOrderPageKey(query models.OrderQuery) (string, error) {
+	if query.CustomerID == 0 {
+		return "", errors.New("order page is not scoped to a customer")
+	}
+	version, err := c.client.Get(context.Background(), buildCustomerOrdersVersionKey(query.CustomerID)).Result()
+	if err == redis.Nil {
+		version = "0"
+	} else if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.Sum(data)
+	return "Customer:" + strconv.Itoa(query.CustomerID) + ":Orders:" + version + ":" + hex.EncodeToString(hash[:]), nil
+}
+
+func buildCustomerOrdersVersionKey(customerID int) string {
+	return "Customer:" + strconv.Itoa(customerID) + ":Orders:version"
 }
 
 func buildOrderKey(id int) string {
 	return "Order:" + strconv.Itoa(id)
 }
+
+func buildIdempotencyKey(key string) string {
+	return "Idempotency:" + key
+}
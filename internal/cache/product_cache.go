@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"order_food_online/internal/models"
 	"strconv"
@@ -11,12 +13,18 @@ import (
 )
 
 type ProductCache interface {
-	GetAllProducts() ([]models.Product, error)
-	SetAllProducts([]models.Product, time.Duration) error
+	GetProductPage(models.ProductQuery) (*models.ProductPage, error)
+	SetProductPage(models.ProductQuery, *models.ProductPage, time.Duration) error
+	InvalidateProductPages() error
 	GetProductByID(int) (*models.Product, error)
 	SetProductByID(int, *models.Product, time.Duration) error
+	DeleteProductByID(int) error
 }
 
+// productPagesVersionKey holds a counter that is part of every product page key,
+// so bumping it invalidates all cached pages at once.
+const productPagesVersionKey = "products:version"
+
 type redisProductCache struct {
 	client *redis.Client
 }
@@ -25,25 +33,39 @@ func NewProductCache(client *redis.Client) ProductCache {
 	return &redisProductCache{client: client}
 }
 
-func (c *redisProductCache) GetAllProducts() ([]models.Product, error) {
-	data, err := c.client.Get(context.Background(), "products").Result()
+func (c *redisProductCache) GetProductPage(query models.ProductQuery) (*models.ProductPage, error) {
+	key, err := c.buildProductPageKey(query)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.client.Get(context.Background(), key).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	var products []models.Product
-	if err := json.Unmarshal([]byte(data), &products); err != nil {
+	var page models.ProductPage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
 		return nil, err
 	}
-	return products, nil
+	return &page, nil
 }
 
-func (c *redisProductCache) SetAllProducts(products []models.Product, ttl time.Duration) error {
-	data, err := json.Marshal(products)
+func (c *redisProductCache) SetProductPage(query models.ProductQuery, page *models.ProductPage, ttl time.Duration) error {
+	key, err := c.buildProductPageKey(query)
 	if err != nil {
 		return err
 	}
-	return c.client.Set(context.Background(), "products", data, ttl).Err()
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(context.Background(), key, data, ttl).Err()
+}
+
+func (c *redisProductCache) InvalidateProductPages() error {
+	return c.client.Incr(context.Background(), productPagesVersionKey).Err()
 }
 
 func (c *redisProductCache) GetProductByID(id int) (*models.Product, error) {
@@ -67,6 +89,27 @@ func (c *redisProductCache) SetProductByID(id int, product *models.Product, ttl
 	return c.client.Set(context.Background(), buildProductKey(id), data, ttl).Err()
 }
 
+func (c *redisProductCache) DeleteProductByID(id int) error {
+	return c.client.Del(context.Background(), buildProductKey(id)).Err()
+}
+
 func buildProductKey(id int) string {
 	return "product:" + strconv.Itoa(id)
 }
+
+// buildProductPageKey derives a key from the current pages version and the query shape.
+func (c *redisProductCache) buildProductPageKey(query models.ProductQuery) (string, error) {
+	version, err := c.client.Get(context.Background(), productPagesVersionKey).Result()
+	if err == redis.Nil {
+		version = "0"
+	} else if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.Sum(data)
+	return "products:" + version + ":" + hex.EncodeToString(hash[:]), nil
+}
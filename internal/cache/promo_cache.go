@@ -12,8 +12,12 @@ import (
 type PromoCodeCache interface {
 	GetPromoCode(string) (*models.PromoCode, error)
 	SetPromoCode(string, *models.PromoCode, time.Duration) error
+	DeletePromoCodes([]string) error
 }
 
+// deleteBatchSize bounds the number of keys removed by a single DEL command
+const deleteBatchSize = 1000
+
 type redisPromoCodeCache struct {
 	client *redis.Client
 }
@@ -43,6 +47,24 @@ func (c *redisPromoCodeCache) SetPromoCode(code string, PromoCode *models.PromoC
 	return c.client.Set(context.Background(), buildPromoCodeKey(code), data, ttl).Err()
 }
 
+func (c *redisPromoCodeCache) DeletePromoCodes(codes []string) error {
+	for start := 0; start < len(codes); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		keys := make([]string, 0, end-start)
+		for _, code := range codes[start:end] {
+			keys = append(keys, buildPromoCodeKey(code))
+		}
+		if err := c.client.Del(context.Background(), keys...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func buildPromoCodeKey(code string) string {
 	return fmt.Sprintf("PromoCode:%s", code)
 }
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Custom error definitions
+var (
+	errFailedToFetchAPIKeys = errors.New("failed to fetch API keys")
+	errFailedToCreateAPIKey = errors.New("failed to create API key")
+	errFailedToRevokeAPIKey = errors.New("failed to revoke API key")
+	errInvalidAPIKeyID      = errors.New("invalid API key ID")
+	errAPIKeyNotFound       = errors.New("API key not found")
+)
+
+// APIKeyHandler handles HTTP requests related to partner API keys
+type APIKeyHandler struct {
+	service *services.APIKeyService
+	logger  *slog.Logger
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler
+func NewAPIKeyHandler(service *services.APIKeyService, logger *slog.Logger) *APIKeyHandler {
+	return &APIKeyHandler{service: service, logger: logger}
+}
+
+// RegisterAPIKeyRoutes sets up the routes for API key endpoints, which are restricted to platform admins
+func (h *APIKeyHandler) RegisterAPIKeyRoutes(e *echo.Echo) {
+	e.GET("/api-keys", h.GetAPIKeys, middleware.RequirePermission(auth.PermManageAPIKeys))
+	e.POST("/api-keys", h.CreateAPIKey, middleware.RequirePermission(auth.PermManageAPIKeys))
+	e.DELETE("/api-keys/:id", h.RevokeAPIKey, middleware.RequirePermission(auth.PermManageAPIKeys))
+}
+
+// GetAPIKeys handles the GET /api-keys request
+func (h *APIKeyHandler) GetAPIKeys(c echo.Context) error {
+	keys, err := h.service.ListAPIKeys()
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToFetchAPIKeys, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToFetchAPIKeys, err)
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey handles the POST /api-keys request. The response holds the key itself,
+// which cannot be retrieved afterwards.
+func (h *APIKeyHandler) CreateAPIKey(c echo.Context) error {
+	var req models.CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	key, err := h.service.CreateAPIKey(req, middleware.Actor(c))
+	if errors.Is(err, models.ErrValidation) {
+		return validationFailed(err)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToCreateAPIKey, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToCreateAPIKey, err)
+	}
+
+	h.logger.Info("API key created", slog.Int("apiKeyID", key.ID), slog.Any("scopes", key.Scopes), slog.String("by", middleware.Actor(c)))
+	return c.JSON(http.StatusCreated, key)
+}
+
+// RevokeAPIKey handles the DELETE /api-keys/:id request
+func (h *APIKeyHandler) RevokeAPIKey(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errInvalidAPIKeyID, err)
+		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
+		return invalidPayload(errInvalidAPIKeyID.Error(), err)
+	}
+
+	err = h.service.RevokeAPIKey(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(errAPIKeyNotFound)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToRevokeAPIKey, err)
+		h.logger.Error(err.Error(), slog.Int("apiKeyID", id), "error", err)
+		return internalError(errFailedToRevokeAPIKey, err)
+	}
+
+	h.logger.Info("API key revoked", slog.Int("apiKeyID", id), slog.String("by", middleware.Actor(c)))
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Custom error definitions
+var (
+	errFailedToRegister     = errors.New("failed to register")
+	errFailedToLogin        = errors.New("failed to log in")
+	errFailedToRefreshToken = errors.New("failed to refresh token")
+	errFailedToLogout       = errors.New("failed to log out")
+	errInvalidUserID        = errors.New("invalid user ID")
+	errUserNotFound         = errors.New("user not found")
+	errFailedToSetRole      = errors.New("failed to set role")
+)
+
+// AuthHandler handles HTTP requests related to customer accounts
+type AuthHandler struct {
+	service *services.AuthService
+	logger  *slog.Logger
+}
+
+// NewAuthHandler creates a new AuthHandler
+func NewAuthHandler(service *services.AuthService, logger *slog.Logger) *AuthHandler {
+	return &AuthHandler{service: service, logger: logger}
+}
+
+// RegisterAuthRoutes sets up the routes for account endpoints. The /auth routes are always public,
+// and only set up when the API issues tokens to customer accounts.
+func (h *AuthHandler) RegisterAuthRoutes(e *echo.Echo) {
+	if h.service.IssuesTokens() {
+		e.POST("/auth/register", h.Register)
+		e.POST("/auth/login", h.Login)
+		e.POST("/auth/refresh", h.Refresh)
+		e.POST("/auth/logout", h.Logout)
+	}
+
+	// Roles are granted by platform admins
+	e.PUT("/users/:id/role", h.SetUserRole, middleware.RequirePermission(auth.PermManageUsers))
+}
+
+// Register handles the POST /auth/register request
+func (h *AuthHandler) Register(c echo.Context) error {
+	var req models.RegisterRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	user, err := h.service.Register(req)
+	switch {
+	case errors.Is(err, models.ErrValidation):
+		return validationFailed(err)
+	case errors.Is(err, services.ErrEmailTaken):
+		return err
+	case err != nil:
+		err := fmt.Errorf("%w: %v", errFailedToRegister, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToRegister, err)
+	}
+
+	h.logger.Info("Customer registered", slog.Int("userID", user.ID))
+	return c.JSON(http.StatusCreated, user)
+}
+
+// Login handles the POST /auth/login request
+func (h *AuthHandler) Login(c echo.Context) error {
+	var req models.LoginRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	tokens, err := h.service.Login(req)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		return err
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToLogin, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToLogin, err)
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh handles the POST /auth/refresh request
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	var req models.RefreshRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+	if req.RefreshToken == "" {
+		return validationFailed(models.ValidationErrors{{Field: "refresh_token", Message: "is required"}})
+	}
+
+	tokens, err := h.service.Refresh(req.RefreshToken)
+	if errors.Is(err, services.ErrInvalidRefreshToken) {
+		return err
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToRefreshToken, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToRefreshToken, err)
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Logout handles the POST /auth/logout request. It succeeds whether or not the token is known.
+func (h *AuthHandler) Logout(c echo.Context) error {
+	var req models.RefreshRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+	if req.RefreshToken == "" {
+		return validationFailed(models.ValidationErrors{{Field: "refresh_token", Message: "is required"}})
+	}
+
+	if err := h.service.Logout(req.RefreshToken); err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToLogout, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToLogout, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetUserRole handles the PUT /users/:id/role request
+func (h *AuthHandler) SetUserRole(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errInvalidUserID, err)
+		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
+		return invalidPayload(errInvalidUserID.Error(), err)
+	}
+
+	var req models.RoleRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	user, err := h.service.SetRole(id, req)
+	switch {
+	case errors.Is(err, models.ErrValidation):
+		return validationFailed(err)
+	case errors.Is(err, sql.ErrNoRows):
+		return notFound(errUserNotFound)
+	case err != nil:
+		err := fmt.Errorf("%w: %v", errFailedToSetRole, err)
+		h.logger.Error(err.Error(), slog.Int("userID", id), "error", err)
+		return internalError(errFailedToSetRole, err)
+	}
+
+	h.logger.Info("User role updated", slog.Int("userID", id), slog.String("role", user.Role), slog.String("by", middleware.Actor(c)))
+	return c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"order_food_online/internal/cache"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Custom error definitions
+var (
+	errFailedToFetchCart  = errors.New("failed to fetch cart")
+	errFailedToUpdateCart = errors.New("failed to update cart")
+	errFailedToMergeCart  = errors.New("failed to merge cart")
+	errCartConflict       = errors.New("cart was changed by another request, try again")
+)
+
+// cartIDHeader carries the guest ID of the cart of an anonymous visitor. The API hands one out
+// in this header when an anonymous visitor first fills a cart.
+const cartIDHeader = "X-Cart-ID"
+
+// CartHandler handles HTTP requests related to shopping carts
+type CartHandler struct {
+	service *services.CartService
+	logger  *slog.Logger
+}
+
+// NewCartHandler creates a new CartHandler
+func NewCartHandler(service *services.CartService, logger *slog.Logger) *CartHandler {
+	return &CartHandler{service: service, logger: logger}
+}
+
+// RegisterCartRoutes sets up the routes for cart endpoints. Anonymous visitors can fill a cart,
+// but checking out requires to log in.
+func (h *CartHandler) RegisterCartRoutes(e *echo.Echo) {
+	e.GET("/cart", h.GetCart)
+	e.POST("/cart/items", h.AddItem)
+	e.PATCH("/cart/items/:product_id", h.UpdateItem)
+	e.DELETE("/cart/items/:product_id", h.RemoveItem)
+	e.PUT("/cart/coupon", h.ApplyCoupon)
+	e.DELETE("/cart/coupon", h.RemoveCoupon)
+	e.POST("/cart/checkout", h.Checkout, middleware.RequirePermission(auth.PermPlaceOrders))
+}
+
+// GetCart handles the GET /cart request. It supports a currency query parameter, as do the
+// other cart routes.
+func (h *CartHandler) GetCart(c echo.Context) error {
+	owner, err := h.cartOwner(c, false)
+	if err != nil {
+		return err
+	}
+
+	cart, err := h.service.GetCart(owner, c.QueryParam("currency"))
+	if isCurrencyError(err) {
+		return err
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToFetchCart, err)
+		h.logger.Error(err.Error(), slog.String("cart", owner.Key()), "error", err)
+		return internalError(errFailedToFetchCart, err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// AddItem handles the POST /cart/items request
+func (h *CartHandler) AddItem(c echo.Context) error {
+	var req models.CartItemRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	owner, err := h.cartOwner(c, true)
+	if err != nil {
+		return err
+	}
+	cart, err := h.service.AddItem(owner, req, c.QueryParam("currency"))
+	if err != nil {
+		return h.cartError(owner, err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// UpdateItem handles the PATCH /cart/items/:product_id request, which sets the quantity of a product
+func (h *CartHandler) UpdateItem(c echo.Context) error {
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var req models.CartItemRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+	req.ProductID = productID
+
+	owner, err := h.cartOwner(c, true)
+	if err != nil {
+		return err
+	}
+	cart, err := h.service.SetItemQuantity(owner, req, c.QueryParam("currency"))
+	if err != nil {
+		return h.cartError(owner, err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// RemoveItem handles the DELETE /cart/items/:product_id request
+func (h *CartHandler) RemoveItem(c echo.Context) error {
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	owner, err := h.cartOwner(c, true)
+	if err != nil {
+		return err
+	}
+	cart, err := h.service.RemoveItem(owner, productID, c.QueryParam("currency"))
+	if err != nil {
+		return h.cartError(owner, err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// ApplyCoupon handles the PUT /cart/coupon request
+func (h *CartHandler) ApplyCoupon(c echo.Context) error {
+	var req models.CartCouponRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	owner, err := h.cartOwner(c, true)
+	if err != nil {
+		return err
+	}
+	cart, err := h.service.ApplyCoupon(owner, req.Code, c.QueryParam("currency"))
+	if err != nil {
+		return h.cartError(owner, err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// RemoveCoupon handles the DELETE /cart/coupon request
+func (h *CartHandler) RemoveCoupon(c echo.Context) error {
+	owner, err := h.cartOwner(c, true)
+	if err != nil {
+		return err
+	}
+	cart, err := h.service.RemoveCoupon(owner, c.QueryParam("currency"))
+	if err != nil {
+		return h.cartError(owner, err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// Checkout handles the POST /cart/checkout request, which places an order for the content of
+// the cart and empties it
+func (h *CartHandler) Checkout(c echo.Context) error {
+	owner, err := h.cartOwner(c, false)
+	if err != nil {
+		return err
+	}
+
+	order, err := h.service.Checkout(owner, c.QueryParam("currency"))
+	var rejected *services.CouponRejectedError
+	var unavailable *services.UnavailableItemsError
+	switch {
+	case errors.As(err, &rejected):
+		return couponRejected(rejected.Reason)
+	case errors.As(err, &unavailable):
+		apiErr := newAPIError(http.StatusConflict, CodeOutOfStock, "Some products of the cart can't be ordered: remove them to check out", err)
+		for _, line := range unavailable.Lines {
+			apiErr.Details = append(apiErr.Details, models.FieldError{Field: fmt.Sprintf("items[%d].product_id", line.Line), Message: line.Reason})
+		}
+		return apiErr
+	case errors.Is(err, models.ErrValidation):
+		return validationFailed(err)
+	case errors.Is(err, services.ErrProductNotFound):
+		return err
+	case err != nil:
+		// The request has no items to point at: errors about products name the whole cart
+		return placeOrderError(h.logger, models.OrderRequest{}, err)
+	}
+
+	h.logger.Info("Cart checked out", slog.String("cart", owner.Key()), slog.Int("OrderID", order.ID))
+	return c.JSON(http.StatusCreated, order)
+}
+
+// cartOwner works out whose cart the request is about: the customer's when logged in, else the
+// one of the guest ID in the X-Cart-ID header. The first time a customer sends both, the guest
+// cart is merged into theirs and the guest ID can be dropped. When create is true, anonymous
+// visitors without a cart get a guest ID. Partners using an API key fill guest carts too.
+func (h *CartHandler) cartOwner(c echo.Context, create bool) (models.CartOwner, error) {
+	guestID := c.Request().Header.Get(cartIDHeader)
+	if guestID != "" && !models.IsGuestID(guestID) {
+		return models.CartOwner{}, validationFailed(models.ValidationErrors{{Field: cartIDHeader, Message: "must be a cart ID handed out by the API"}})
+	}
+
+	if userID, ok := customerID(c); ok {
+		if guestID != "" {
+			err := h.service.MergeGuestCart(guestID, userID)
+			if errors.Is(err, cache.ErrCartConflict) {
+				return models.CartOwner{}, newAPIError(http.StatusConflict, CodeConflict, errCartConflict.Error(), err)
+			}
+			if err != nil {
+				err := fmt.Errorf("%w: %v", errFailedToMergeCart, err)
+				h.logger.Error(err.Error(), slog.Int("userID", userID), "error", err)
+				return models.CartOwner{}, internalError(errFailedToMergeCart, err)
+			}
+		}
+		return models.CartOwner{UserID: userID}, nil
+	}
+
+	if guestID == "" && create {
+		var err error
+		if guestID, err = h.service.NewGuestID(); err != nil {
+			err := fmt.Errorf("%w: %v", errFailedToUpdateCart, err)
+			h.logger.Error(err.Error(), "error", err)
+			return models.CartOwner{}, internalError(errFailedToUpdateCart, err)
+		}
+	}
+	if guestID != "" {
+		c.Response().Header().Set(cartIDHeader, guestID)
+	}
+	owner := models.CartOwner{GuestID: guestID}
+	if principal := middleware.Principal(c); principal != nil {
+		owner.APIKeyID = principal.APIKeyID
+	}
+	return owner, nil
+}
+
+// cartError reports why a cart could not be changed.
+func (h *CartHandler) cartError(owner models.CartOwner, err error) error {
+	var rejected *services.CouponRejectedError
+	switch {
+	case errors.As(err, &rejected):
+		return couponRejected(rejected.Reason)
+	case errors.Is(err, models.ErrValidation):
+		return validationFailed(err)
+	case errors.Is(err, services.ErrCartItemNotFound):
+		return notFound(services.ErrCartItemNotFound)
+	case errors.Is(err, cache.ErrCartConflict):
+		h.logger.Warn("Cart kept changing while updated", slog.String("cart", owner.Key()))
+		return newAPIError(http.StatusConflict, CodeConflict, errCartConflict.Error(), err)
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, repository.ErrOutOfStock), isCurrencyError(err):
+		return err
+	}
+	err = fmt.Errorf("%w: %v", errFailedToUpdateCart, err)
+	h.logger.Error(err.Error(), slog.String("cart", owner.Key()), "error", err)
+	return internalError(errFailedToUpdateCart, err)
+}
+
+// productIDParam parses the :product_id route parameter.
+func productIDParam(c echo.Context) (int, error) {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		return 0, invalidPayload(errInvalidProductID.Error(), fmt.Errorf("%w: %v", errInvalidProductID, err))
+	}
+	return productID, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Custom error definitions
+var (
+	errFailedToFetchRates = errors.New("failed to fetch exchange rates")
+	errFailedToSaveRates  = errors.New("failed to save exchange rates")
+	errRateNotFound       = errors.New("exchange rate not found")
+)
+
+// CurrencyHandler handles HTTP requests related to currencies and exchange rates
+type CurrencyHandler struct {
+	service *services.CurrencyService
+	logger  *slog.Logger
+}
+
+// NewCurrencyHandler creates a new CurrencyHandler
+func NewCurrencyHandler(service *services.CurrencyService, logger *slog.Logger) *CurrencyHandler {
+	return &CurrencyHandler{service: service, logger: logger}
+}
+
+// RegisterCurrencyRoutes sets up the routes for exchange rate endpoints
+func (h *CurrencyHandler) RegisterCurrencyRoutes(e *echo.Echo) {
+	e.GET("/exchange-rates", h.GetExchangeRates)
+
+	// Rates are maintained by platform admins
+	e.PUT("/exchange-rates", h.SetExchangeRates, middleware.RequirePermission(auth.PermManagePricing))
+	e.DELETE("/exchange-rates/:currency", h.DeleteExchangeRate, middleware.RequirePermission(auth.PermManagePricing))
+}
+
+// GetExchangeRates handles the GET /exchange-rates request
+func (h *CurrencyHandler) GetExchangeRates(c echo.Context) error {
+	rates, err := h.service.ListRates()
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToFetchRates, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToFetchRates, err)
+	}
+	return c.JSON(http.StatusOK, rates)
+}
+
+// SetExchangeRates handles the PUT /exchange-rates request.
+// Currencies missing from the request keep their current rate.
+func (h *CurrencyHandler) SetExchangeRates(c echo.Context) error {
+	var ratesReq models.ExchangeRatesRequest
+	if err := c.Bind(&ratesReq); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	err := h.service.SetRates(ratesReq)
+	if errors.Is(err, models.ErrInvalidCurrency) || errors.Is(err, models.ErrInvalidRate) {
+		return validationFailed(err)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveRates, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToSaveRates, err)
+	}
+
+	h.logger.Info("Exchange rates updated", slog.Int("currencies", len(ratesReq.Rates)), slog.String("by", middleware.Actor(c)))
+	return h.GetExchangeRates(c)
+}
+
+// DeleteExchangeRate handles the DELETE /exchange-rates/:currency request
+func (h *CurrencyHandler) DeleteExchangeRate(c echo.Context) error {
+	currency := c.Param("currency")
+	err := h.service.DeleteRate(currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(errRateNotFound)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveRates, err)
+		h.logger.Error(err.Error(), slog.String("currency", currency), "error", err)
+		return internalError(errFailedToSaveRates, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// isCurrencyError reports whether err comes from an invalid or unsupported currency selection.
+func isCurrencyError(err error) bool {
+	return errors.Is(err, models.ErrInvalidCurrency) || errors.Is(err, models.ErrUnsupportedCurrency)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Error codes reported in error responses
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeOutOfStock           = "out_of_stock"
+	CodeCouponUnavailable    = "coupon_unavailable"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeTooManyRequests      = "too_many_requests"
+	CodeInternal             = "internal_error"
+)
+
+// couponRejectedCodePrefix prefixes the reason a coupon was rejected, e.g. coupon_expired
+const couponRejectedCodePrefix = "coupon_"
+
+// ErrorBody is the envelope of every error response.
+type ErrorBody struct {
+	Error ErrorResponse `json:"error"`
+}
+
+// ErrorResponse describes an error to clients: a stable code to branch on, a human readable
+// message and, for rejected requests, the offending fields.
+type ErrorResponse struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Details []models.FieldError `json:"details,omitempty"`
+}
+
+// APIError is an error returned by a handler along with how to report it.
+// Err is the underlying cause; it is kept for logs and never sent to clients.
+type APIError struct {
+	Status int
+	ErrorResponse
+	Err error
+}
+
+func (e *APIError) Error() string {
+	if e.Err == nil || e.Err.Error() == e.Message {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError creates an APIError without details.
+func newAPIError(status int, code, message string, err error) *APIError {
+	return &APIError{Status: status, ErrorResponse: ErrorResponse{Code: code, Message: message}, Err: err}
+}
+
+// invalidPayload reports a body or query string that could not be decoded.
+func invalidPayload(message string, err error) *APIError {
+	return newAPIError(http.StatusBadRequest, CodeInvalidRequest, message, err)
+}
+
+// validationFailed reports a request rejected by validation, listing the rejected fields
+// when err is a models.ValidationErrors.
+func validationFailed(err error) *APIError {
+	apiErr := newAPIError(http.StatusBadRequest, CodeValidationFailed, err.Error(), err)
+	var fieldErrs models.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		apiErr.Message = "request is invalid"
+		apiErr.Details = fieldErrs
+	}
+	return apiErr
+}
+
+// notFound reports a missing resource with the handler's own message.
+func notFound(message error) *APIError {
+	return newAPIError(http.StatusNotFound, CodeNotFound, message.Error(), nil)
+}
+
+// internalError reports a failure with a generic message, keeping the cause for logs.
+func internalError(message error, err error) *APIError {
+	return newAPIError(http.StatusInternalServerError, CodeInternal, message.Error(), err)
+}
+
+// domainErrors maps the errors of the service and repository layers to how they are reported
+// when a handler returns them as is. sql.ErrNoRows is not one of them: which resource is
+// missing depends on the request, so handlers report it themselves.
+var domainErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{models.ErrValidation, http.StatusBadRequest, CodeValidationFailed},
+	{models.ErrInvalidCursor, http.StatusBadRequest, CodeValidationFailed},
+	{models.ErrInvalidCurrency, http.StatusBadRequest, CodeValidationFailed},
+	{models.ErrUnsupportedCurrency, http.StatusBadRequest, CodeValidationFailed},
+	{models.ErrInvalidOrderStatus, http.StatusBadRequest, CodeValidationFailed},
+	{services.ErrProductNotFound, http.StatusBadRequest, CodeValidationFailed},
+	{services.ErrEmailTaken, http.StatusConflict, CodeConflict},
+	{services.ErrInvalidCredentials, http.StatusUnauthorized, CodeUnauthorized},
+	{services.ErrInvalidRefreshToken, http.StatusUnauthorized, CodeUnauthorized},
+	{services.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused},
+	{repository.ErrUnknownProduct, http.StatusBadRequest, CodeValidationFailed},
+	{repository.ErrOutOfStock, http.StatusConflict, CodeOutOfStock},
+	{repository.ErrCouponRedemptionLimit, http.StatusConflict, CodeCouponUnavailable},
+	{repository.ErrInvalidStatusTransition, http.StatusConflict, CodeConflict},
+	{repository.ErrCancellationClosed, http.StatusConflict, CodeConflict},
+}
+
+// toAPIError works out how to report err. Errors the handlers did not anticipate become
+// internal errors, so their messages never reach clients.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		message, ok := httpErr.Message.(string)
+		if !ok {
+			message = http.StatusText(httpErr.Code)
+		}
+		return newAPIError(httpErr.Code, statusCode(httpErr.Code), message, httpErr.Internal)
+	}
+
+	for _, domainErr := range domainErrors {
+		if errors.Is(err, domainErr.err) {
+			apiErr = newAPIError(domainErr.status, domainErr.code, domainMessage(err, domainErr.err), err)
+			var fieldErrs models.ValidationErrors
+			if errors.As(err, &fieldErrs) {
+				apiErr.Details = fieldErrs
+			}
+			return apiErr
+		}
+	}
+	return newAPIError(http.StatusInternalServerError, CodeInternal, "internal server error", err)
+}
+
+// domainMessage returns the message of the domain error err wraps, with the details it adds
+// to the sentinel but without the context outer layers add, such as "failed to place order: ".
+func domainMessage(err, sentinel error) string {
+	var fieldErrs models.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		return "request is invalid"
+	}
+	var outOfStock *repository.OutOfStockError
+	if errors.As(err, &outOfStock) {
+		return outOfStock.Error()
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if strings.HasPrefix(e.Error(), sentinel.Error()) {
+			return e.Error()
+		}
+	}
+	return sentinel.Error()
+}
+
+// statusCode returns the error code of responses with the given HTTP status.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// NewHTTPErrorHandler returns the Echo error handler writing every error returned by handlers
+// and middlewares in the ErrorBody envelope.
+func NewHTTPErrorHandler(logger *slog.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		apiErr := toAPIError(err)
+		if apiErr.Status >= http.StatusInternalServerError {
+			logger.Error("Request failed", slog.String("method", c.Request().Method),
+				slog.String("path", c.Path()), "error", err)
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(apiErr.Status)
+		} else {
+			err = c.JSON(apiErr.Status, ErrorBody{Error: apiErr.ErrorResponse})
+		}
+		if err != nil {
+			logger.Error("Failed to write error response", "error", err)
+		}
+	}
+}
@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
 	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
 	"strconv"
+	"time"
 
+	"github.com/guregu/null"
+	"github.com/guregu/null/zero"
 	"github.com/labstack/echo/v4"
 )
 
@@ -17,6 +24,14 @@ var (
 	errFailedToFetchOrders = errors.New("failed to fetch orders")
 	errInvalidOrderID      = errors.New("invalid order ID")
 	errOrderNotFound       = errors.New("order not found")
+	errFailedToUpdateOrder = errors.New("failed to update order")
+	errFailedToPlaceOrder  = errors.New("failed to place order")
+)
+
+// Headers used to make order placement idempotent
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
 )
 
 // OrderHandler handles HTTP requests related to Orders
@@ -27,44 +42,133 @@ type OrderHandler struct {
 }
 
 // NewOrderHandler creates a new OrderHandler
-func NewOrderHandler(service *services.OrderService, logger *slog.Logger) *OrderHandler {
-	return &OrderHandler{service: service, logger: logger}
+func NewOrderHandler(service *services.OrderService, promoCodeService *services.PromoCodeService, logger *slog.Logger) *OrderHandler {
+	return &OrderHandler{service: service, promoCodeService: promoCodeService, logger: logger}
 }
 
 // RegisterOrderRoutes sets up the routes for Order-related endpoints
 func (h *OrderHandler) RegisterOrderRoutes(e *echo.Echo) {
 	e.GET("/orders", h.GetOrders)
-	e.POST("/orders", h.PlaceOrder)
+	e.POST("/orders", h.PlaceOrder, middleware.RequirePermission(auth.PermPlaceOrders))
 	e.GET("/orders/:id", h.GetOrderByID)
+	e.POST("/orders/:id/cancel", h.CancelOrder)
+
+	// Orders of the customer who is logged in
+	e.GET("/me/orders", h.GetMyOrders)
+	e.GET("/me/orders/:id", h.GetMyOrderByID)
+
+	// Order lifecycle is driven by staff
+	e.PATCH("/orders/:id/status", h.UpdateOrderStatus, middleware.RequirePermission(auth.PermUpdateOrderStatus))
+	e.GET("/orders/:id/history", h.GetOrderStatusHistory, middleware.RequirePermission(auth.PermReadAllOrders))
 }
 
-// GetOrders handles the GET /Orders request
+// GetOrders handles the GET /Orders request.
+// It supports cursor, limit, from, to, coupon_code, status and currency query parameters.
+// Staff and admins see every order; partners see the orders placed with their API key, and
+// customers only see their own, as on GET /me/orders.
 func (h *OrderHandler) GetOrders(c echo.Context) error {
-	Orders, err := h.service.GetAllOrders()
+	if principal := middleware.Principal(c); principal != nil {
+		if principal.Can(auth.PermReadAllOrders) {
+			return h.listOrders(c, models.OrderQuery{})
+		}
+		if principal.APIKeyID != 0 {
+			return h.listOrders(c, models.OrderQuery{APIKeyID: principal.APIKeyID})
+		}
+	}
+	return h.GetMyOrders(c)
+}
+
+// GetMyOrders handles the GET /me/orders request, with the query parameters of GET /orders.
+func (h *OrderHandler) GetMyOrders(c echo.Context) error {
+	userID, err := requireCustomer(c)
+	if err != nil {
+		return err
+	}
+	return h.listOrders(c, models.OrderQuery{CustomerID: userID})
+}
+
+// listOrders responds with the page of orders the query parameters select, restricted to the
+// orders of the customer or API key set in owner, if any.
+func (h *OrderHandler) listOrders(c echo.Context, owner models.OrderQuery) error {
+	var query models.OrderQuery
+	err := echo.QueryParamsBinder(c).
+		String("cursor", &query.Cursor).
+		Int("limit", &query.Limit).
+		CustomFunc("from", bindTime(&query.From)).
+		CustomFunc("to", bindTime(&query.To)).
+		String("coupon_code", &query.CouponCode).
+		String("status", (*string)(&query.Status)).
+		String("currency", &query.Currency).
+		BindError()
+	if err != nil {
+		h.logger.Error("Invalid query parameters", slog.String("error", err.Error()))
+		return invalidPayload("Invalid query parameters", err)
+	}
+
+	query.Normalize()
+	if err := query.Validate(); err != nil {
+		return validationFailed(err)
+	}
+	query.CustomerID = owner.CustomerID
+	query.APIKeyID = owner.APIKeyID
+
+	Orders, err := h.service.ListOrders(query)
+	if errors.Is(err, models.ErrInvalidCursor) {
+		return validationFailed(err)
+	}
 	if err != nil {
 		err := fmt.Errorf("%w: %v", errFailedToFetchOrders, err)
 		h.logger.Error(err.Error(), "error", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": errFailedToFetchOrders.Error()})
+		return internalError(errFailedToFetchOrders, err)
 	}
 	return c.JSON(http.StatusOK, Orders)
 }
 
-// GetOrderByID handles the GET /Orders/:id request
+// GetOrderByID handles the GET /Orders/:id request.
+// Orders placed by other customers are reported as not found.
 func (h *OrderHandler) GetOrderByID(c echo.Context) error {
+	order, err := h.findOrder(c)
+	if err != nil {
+		return err
+	}
+	if !canSeeOrder(c, order) {
+		return notFound(errOrderNotFound)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// GetMyOrderByID handles the GET /me/orders/:id request
+func (h *OrderHandler) GetMyOrderByID(c echo.Context) error {
+	userID, err := requireCustomer(c)
+	if err != nil {
+		return err
+	}
+	order, err := h.findOrder(c)
+	if err != nil {
+		return err
+	}
+	if order.CustomerID.Int64 != int64(userID) {
+		return notFound(errOrderNotFound)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// findOrder fetches the order of the :id route parameter.
+func (h *OrderHandler) findOrder(c echo.Context) (*models.Order, error) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		err := fmt.Errorf("%w: %v", errInvalidOrderID, err)
 		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errInvalidOrderID.Error()})
+		return nil, invalidPayload(errInvalidOrderID.Error(), err)
 	}
 
-	Order, err := h.service.GetOrderByID(id)
+	order, err := h.service.GetOrderByID(id)
 	if err != nil {
 		err := fmt.Errorf("%w: %v", errOrderNotFound, err)
 		h.logger.Error(err.Error(), slog.Int("OrderID", id), "error", err)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errOrderNotFound.Error()})
+		return nil, notFound(errOrderNotFound)
 	}
-	return c.JSON(http.StatusOK, Order)
+	return order, nil
 }
 
 // PlaceOrder handles the POST /Orders request
@@ -74,39 +178,257 @@ func (h *OrderHandler) PlaceOrder(c echo.Context) error {
 	// Bind the request body to OrderRequest
 	if err := c.Bind(&orderReq); err != nil {
 		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		return invalidPayload("Invalid request payload", err)
 	}
 
-	// check promo code
-	if orderReq.CouponCode.Valid && orderReq.CouponCode.String != "" {
-		ok, err := h.promoCodeService.ValidatePromo(orderReq.CouponCode.String)
+	orderReq.Normalize()
+	if err := orderReq.Validate(); err != nil {
+		return validationFailed(err)
+	}
+
+	// Tie the order to the customer who is logged in or the partner API key, if any
+	if userID, ok := customerID(c); ok {
+		orderReq.CustomerID = zero.IntFrom(int64(userID))
+	}
+	if principal := middleware.Principal(c); principal != nil && principal.APIKeyID != 0 {
+		orderReq.APIKeyID = zero.IntFrom(int64(principal.APIKeyID))
+	}
+
+	// Replay the original response of a retried request
+	if key := c.Request().Header.Get(idempotencyKeyHeader); key != "" {
+		if err := models.ValidateIdempotencyKey(key); err != nil {
+			return validationFailed(models.ValidationErrors{{Field: idempotencyKeyHeader, Message: err.Error()}})
+		}
+		orderReq.IdempotencyKey = key
+
+		order, err := h.service.ReplayOrder(orderReq)
+		if errors.Is(err, services.ErrIdempotencyKeyReused) {
+			h.logger.Warn("Idempotency key reused with a different payload", slog.String("key", key))
+			return err
+		}
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+			h.logger.Error("Failed to look up idempotency key", slog.String("key", key), "error", err)
+			return internalError(errFailedToPlaceOrder, err)
 		}
-		if !ok {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid coupon"})
+		if order != nil {
+			c.Response().Header().Set(idempotentReplayedHeader, "true")
+			return c.JSON(http.StatusCreated, order)
 		}
 	}
 
-	// Validate that products exist
-	for _, item := range orderReq.Items {
-		productExists, err := h.service.CheckProductExists(item.ProductID)
+	// check promo code
+	if orderReq.CouponCode.Valid && orderReq.CouponCode.String != "" {
+		quote, err := h.promoCodeService.ValidatePromo(orderReq.CouponCode.String, orderReq.Items, orderReq.Currency)
+		if errors.Is(err, services.ErrProductNotFound) || isCurrencyError(err) {
+			return err
+		}
 		if err != nil {
-			h.logger.Error("Failed to check product existence", slog.Int("productID", item.ProductID), "error", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+			h.logger.Error("Failed to validate coupon", slog.String("code", orderReq.CouponCode.String), "error", err)
+			return internalError(errFailedToPlaceOrder, err)
 		}
-		if !productExists {
-			h.logger.Warn("Product does not exist", slog.Int("productID", item.ProductID))
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Product with ID %d does not exist", item.ProductID)})
+		if !quote.Valid {
+			return couponRejected(quote.Reason)
 		}
 	}
 
 	// Place the order
 	order, err := h.service.PlaceOrder(orderReq)
 	if err != nil {
-		h.logger.Error("Failed to place order", slog.String("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to place order"})
+		return placeOrderError(h.logger, orderReq, err)
 	}
 
 	return c.JSON(http.StatusCreated, order)
 }
+
+// UpdateOrderStatus handles the PATCH /orders/:id/status request
+func (h *OrderHandler) UpdateOrderStatus(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errInvalidOrderID, err)
+		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
+		return invalidPayload(errInvalidOrderID.Error(), err)
+	}
+
+	var statusReq models.OrderStatusRequest
+	if err := c.Bind(&statusReq); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	order, err := h.service.UpdateOrderStatus(id, statusReq, middleware.Actor(c))
+	switch {
+	case errors.Is(err, models.ErrInvalidOrderStatus):
+		return validationFailed(err)
+	case errors.Is(err, sql.ErrNoRows):
+		return notFound(errOrderNotFound)
+	case errors.Is(err, repository.ErrInvalidStatusTransition):
+		h.logger.Warn("Rejected order status transition", slog.Int("OrderID", id), "error", err)
+		return err
+	case err != nil:
+		err := fmt.Errorf("%w: %v", errFailedToUpdateOrder, err)
+		h.logger.Error(err.Error(), slog.Int("OrderID", id), "error", err)
+		return internalError(errFailedToUpdateOrder, err)
+	}
+
+	h.logger.Info("Order status updated", slog.Int("OrderID", id), slog.String("status", string(order.Status)))
+	return c.JSON(http.StatusOK, order)
+}
+
+// CancelOrder handles the POST /orders/:id/cancel request.
+// Customers and partners can only cancel their own orders.
+func (h *OrderHandler) CancelOrder(c echo.Context) error {
+	order, err := h.findOrder(c)
+	if err != nil {
+		return err
+	}
+	if !canSeeOrder(c, order) {
+		return notFound(errOrderNotFound)
+	}
+	id := order.ID
+
+	var cancelReq models.CancelOrderRequest
+	if err := c.Bind(&cancelReq); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	order, err = h.service.CancelOrder(id, cancelReq, middleware.Actor(c))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return notFound(errOrderNotFound)
+	case errors.Is(err, repository.ErrCancellationClosed):
+		h.logger.Warn("Rejected late order cancellation", slog.Int("OrderID", id), "error", err)
+		return newAPIError(http.StatusConflict, CodeConflict,
+			"Order can no longer be cancelled: the kitchen has already accepted it", err)
+	case err != nil:
+		err := fmt.Errorf("%w: %v", errFailedToUpdateOrder, err)
+		h.logger.Error(err.Error(), slog.Int("OrderID", id), "error", err)
+		return internalError(errFailedToUpdateOrder, err)
+	}
+
+	h.logger.Info("Order cancelled by customer", slog.Int("OrderID", id))
+	return c.JSON(http.StatusOK, order)
+}
+
+// GetOrderStatusHistory handles the GET /orders/:id/history request
+func (h *OrderHandler) GetOrderStatusHistory(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errInvalidOrderID, err)
+		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
+		return invalidPayload(errInvalidOrderID.Error(), err)
+	}
+
+	history, err := h.service.GetOrderStatusHistory(id)
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToFetchOrders, err)
+		h.logger.Error(err.Error(), slog.Int("OrderID", id), "error", err)
+		return internalError(errFailedToFetchOrders, err)
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+// requireCustomer returns the ID of the customer account the request is authenticated with,
+// or the error to respond with when there is none.
+func requireCustomer(c echo.Context) (int, error) {
+	principal := middleware.Principal(c)
+	if principal == nil {
+		return 0, newAPIError(http.StatusUnauthorized, CodeUnauthorized, "authentication required", nil)
+	}
+	userID, ok := principal.UserID()
+	if !ok {
+		return 0, newAPIError(http.StatusForbidden, CodeForbidden, "log in with a customer account to see your orders", nil)
+	}
+	return userID, nil
+}
+
+// canSeeOrder reports whether the caller may see the order: staff and admins see every order,
+// customers and partners only see the orders they placed. Orders placed without a customer
+// account or an API key are only visible to staff.
+func canSeeOrder(c echo.Context, order *models.Order) bool {
+	principal := middleware.Principal(c)
+	if principal == nil {
+		return false
+	}
+	if principal.Can(auth.PermReadAllOrders) {
+		return true
+	}
+	if principal.APIKeyID != 0 {
+		return order.APIKeyID.Valid && order.APIKeyID.Int64 == int64(principal.APIKeyID)
+	}
+	userID, ok := principal.UserID()
+	return ok && order.CustomerID.Valid && int64(userID) == order.CustomerID.Int64
+}
+
+// customerID returns the ID of the customer account the request is authenticated with, if any.
+func customerID(c echo.Context) (int, bool) {
+	principal := middleware.Principal(c)
+	if principal == nil {
+		return 0, false
+	}
+	return principal.UserID()
+}
+
+// placeOrderError reports why an order could not be placed.
+func placeOrderError(logger *slog.Logger, orderReq models.OrderRequest, err error) error {
+	if errors.Is(err, services.ErrIdempotencyKeyReused) || isCurrencyError(err) {
+		return err
+	}
+	if errors.Is(err, repository.ErrCouponRedemptionLimit) {
+		logger.Warn("Coupon redemption limit reached", slog.String("code", orderReq.CouponCode.String))
+		return newAPIError(http.StatusConflict, CodeCouponUnavailable, "Coupon is no longer available", err)
+	}
+	var notApplicable *repository.CouponNotApplicableError
+	if errors.As(err, &notApplicable) {
+		logger.Warn("Coupon no longer applies to the order", slog.String("code", orderReq.CouponCode.String), slog.String("reason", notApplicable.Reason))
+		return couponRejected(notApplicable.Reason)
+	}
+	var unknownProducts *repository.UnknownProductsError
+	if errors.As(err, &unknownProducts) {
+		logger.Warn("Product does not exist", slog.Any("productIDs", unknownProducts.ProductIDs))
+		var errs models.ValidationErrors
+		for _, productID := range unknownProducts.ProductIDs {
+			errs.Add(itemField(orderReq.Items, productID), fmt.Sprintf("product with ID %d does not exist", productID))
+		}
+		return validationFailed(errs)
+	}
+	var outOfStock *repository.OutOfStockError
+	if errors.As(err, &outOfStock) {
+		logger.Warn("Product out of stock", slog.Int("productID", outOfStock.ProductID))
+		apiErr := newAPIError(http.StatusConflict, CodeOutOfStock, outOfStock.Error(), err)
+		apiErr.Details = []models.FieldError{{Field: itemField(orderReq.Items, outOfStock.ProductID), Message: outOfStock.Error()}}
+		return apiErr
+	}
+	logger.Error("Failed to place order", slog.String("error", err.Error()))
+	return internalError(errFailedToPlaceOrder, err)
+}
+
+// couponRejected reports a coupon that does not apply, with the reason why.
+func couponRejected(reason string) *APIError {
+	apiErr := newAPIError(http.StatusBadRequest, couponRejectedCodePrefix+reason, models.CouponReasonMessage(reason), nil)
+	apiErr.Details = []models.FieldError{{Field: "coupon_code", Message: models.CouponReasonMessage(reason)}}
+	return apiErr
+}
+
+// itemField names the product_id field of the first line ordering a product.
+func itemField(items []models.OrderItem, productID int) string {
+	for i, item := range items {
+		if item.ProductID == productID {
+			return fmt.Sprintf("items[%d].product_id", i)
+		}
+	}
+	return "items"
+}
+
+// bindTime parses a query parameter given either as an RFC 3339 timestamp or as a date.
+func bindTime(dest *null.Time) func(values []string) []error {
+	return func(values []string) []error {
+		for _, layout := range []string{time.RFC3339, time.DateOnly} {
+			if t, err := time.Parse(layout, values[0]); err == nil {
+				*dest = null.TimeFrom(t)
+				return nil
+			}
+		}
+		return []error{fmt.Errorf("invalid time %q", values[0])}
+	}
+}
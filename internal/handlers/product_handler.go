@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"order_food_online/internal/models"
 	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
@@ -16,6 +24,16 @@ var (
 	errFailedToFetchProducts = errors.New("failed to fetch products")
 	errInvalidProductID      = errors.New("invalid product ID")
 	errProductNotFound       = errors.New("product not found")
+	errFailedToSaveProduct   = errors.New("failed to save product")
+	errInvalidImport         = errors.New("invalid product import")
+	errTooManyProducts       = errors.New("too many products")
+)
+
+// maxImportedProducts bounds the number of products of a single bulk import, and
+// maxImportSize the size of its body
+const (
+	maxImportedProducts = 10000
+	maxImportSize       = 8 << 20
 )
 
 // ProductHandler handles HTTP requests related to products
@@ -33,33 +51,304 @@ func NewProductHandler(service *services.ProductService, logger *slog.Logger) *P
 func (h *ProductHandler) RegisterProductRoutes(e *echo.Echo) {
 	e.GET("/products", h.GetProducts)
 	e.GET("/products/:id", h.GetProductByID)
+
+	// Catalog management is restricted to restaurant and platform admins
+	e.POST("/products", h.CreateProduct, middleware.RequirePermission(auth.PermManageCatalog))
+	e.POST("/products/import", h.ImportProducts, middleware.RequirePermission(auth.PermManageCatalog))
+	e.PUT("/products/:id", h.UpdateProduct, middleware.RequirePermission(auth.PermManageCatalog))
+	e.PUT("/products/:id/stock", h.SetStock, middleware.RequirePermission(auth.PermManageCatalog))
+	e.DELETE("/products/:id", h.DeleteProduct, middleware.RequirePermission(auth.PermManageCatalog))
 }
 
-// GetProducts handles the GET /products request
+// GetProducts handles the GET /products request.
+// It supports cursor, limit, category, min_price, max_price, q, sort and currency query parameters.
+// Prices, including the min_price and max_price filters and the price sorts, are in the
+// requested currency.
 func (h *ProductHandler) GetProducts(c echo.Context) error {
-	products, err := h.service.GetAllProducts()
+	var query models.ProductQuery
+	err := echo.QueryParamsBinder(c).
+		String("cursor", &query.Cursor).
+		Int("limit", &query.Limit).
+		String("category", &query.Category).
+		TextUnmarshaler("min_price", &query.MinPrice).
+		TextUnmarshaler("max_price", &query.MaxPrice).
+		String("q", &query.Search).
+		String("sort", &query.Sort).
+		String("currency", &query.Currency).
+		BindError()
+	if err != nil {
+		h.logger.Error("Invalid query parameters", slog.String("error", err.Error()))
+		return invalidPayload("Invalid query parameters", err)
+	}
+
+	query.Normalize()
+	if err := query.Validate(); err != nil {
+		return validationFailed(err)
+	}
+
+	products, err := h.service.ListProducts(query)
+	if errors.Is(err, models.ErrInvalidCursor) || isCurrencyError(err) {
+		return validationFailed(err)
+	}
 	if err != nil {
 		err := fmt.Errorf("%w: %v", errFailedToFetchProducts, err)
 		h.logger.Error(err.Error(), "error", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": errFailedToFetchProducts.Error()})
+		return internalError(errFailedToFetchProducts, err)
 	}
 	return c.JSON(http.StatusOK, products)
 }
 
-// GetProductByID handles the GET /products/:id request
+// GetProductByID handles the GET /products/:id request.
+// It supports a currency query parameter.
 func (h *ProductHandler) GetProductByID(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		err := fmt.Errorf("%w: %v", errInvalidProductID, err)
 		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errInvalidProductID.Error()})
+		return invalidPayload(errInvalidProductID.Error(), err)
 	}
 
-	product, err := h.service.GetProductByID(id)
+	product, err := h.service.GetProductByID(id, c.QueryParam("currency"))
+	if isCurrencyError(err) {
+		return validationFailed(err)
+	}
 	if err != nil {
 		err := fmt.Errorf("%w: %v", errProductNotFound, err)
 		h.logger.Error(err.Error(), slog.Int("productID", id), "error", err)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errProductNotFound.Error()})
+		return notFound(errProductNotFound)
+	}
+	return c.JSON(http.StatusOK, product)
+}
+
+// CreateProduct handles the POST /products request
+func (h *ProductHandler) CreateProduct(c echo.Context) error {
+	var productReq models.ProductRequest
+	if err := c.Bind(&productReq); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	productReq.Normalize()
+	if err := productReq.Validate(); err != nil {
+		return validationFailed(err)
+	}
+
+	product, err := h.service.CreateProduct(productReq)
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveProduct, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToSaveProduct, err)
+	}
+	return c.JSON(http.StatusCreated, product)
+}
+
+// UpdateProduct handles the PUT /products/:id request
+func (h *ProductHandler) UpdateProduct(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errInvalidProductID, err)
+		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
+		return invalidPayload(errInvalidProductID.Error(), err)
+	}
+
+	var productReq models.ProductRequest
+	if err := c.Bind(&productReq); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	productReq.Normalize()
+	if err := productReq.Validate(); err != nil {
+		return validationFailed(err)
+	}
+
+	product, err := h.service.UpdateProduct(id, productReq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(errProductNotFound)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveProduct, err)
+		h.logger.Error(err.Error(), slog.Int("productID", id), "error", err)
+		return internalError(errFailedToSaveProduct, err)
+	}
+	return c.JSON(http.StatusOK, product)
+}
+
+// SetStock handles the PUT /products/:id/stock request
+func (h *ProductHandler) SetStock(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errInvalidProductID, err)
+		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
+		return invalidPayload(errInvalidProductID.Error(), err)
+	}
+
+	var stockReq models.StockRequest
+	if err := c.Bind(&stockReq); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+
+	stockReq.Normalize()
+	if err := stockReq.Validate(); err != nil {
+		return validationFailed(err)
+	}
+
+	product, err := h.service.SetStock(id, stockReq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(errProductNotFound)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveProduct, err)
+		h.logger.Error(err.Error(), slog.Int("productID", id), "error", err)
+		return internalError(errFailedToSaveProduct, err)
 	}
+
+	h.logger.Info("Product stock updated", slog.Int("productID", id), slog.String("by", middleware.Actor(c)))
 	return c.JSON(http.StatusOK, product)
 }
+
+// DeleteProduct handles the DELETE /products/:id request
+func (h *ProductHandler) DeleteProduct(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errInvalidProductID, err)
+		h.logger.Error(err.Error(), slog.String("param", c.Param("id")), "error", err)
+		return invalidPayload(errInvalidProductID.Error(), err)
+	}
+
+	err = h.service.DeleteProduct(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(errProductNotFound)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveProduct, err)
+		h.logger.Error(err.Error(), slog.Int("productID", id), "error", err)
+		return internalError(errFailedToSaveProduct, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ImportProducts handles the POST /products/import request.
+// The body is either a JSON array of products or a CSV file with a name,price,category header.
+// Reading stops as soon as the body holds too many products or exceeds maxImportSize.
+func (h *ProductHandler) ImportProducts(c echo.Context) error {
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize)
+	var productReqs []models.ProductRequest
+	var err error
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "text/csv") {
+		productReqs, err = decodeProductsCSV(body)
+	} else {
+		productReqs, err = decodeProductsJSON(body)
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		message := fmt.Sprintf("%v: body exceeds %d bytes", errInvalidImport, maxImportSize)
+		return newAPIError(http.StatusRequestEntityTooLarge, CodeInvalidRequest, message, err)
+	}
+	if err != nil && !errors.Is(err, errTooManyProducts) {
+		err := fmt.Errorf("%w: %v", errInvalidImport, err)
+		h.logger.Error(err.Error(), "error", err)
+		return invalidPayload(err.Error(), err)
+	}
+
+	if len(productReqs) == 0 || errors.Is(err, errTooManyProducts) {
+		return validationFailed(fmt.Errorf("%w: expected between 1 and %d products", errInvalidImport, maxImportedProducts))
+	}
+
+	// Reject the whole import if any product is invalid, listing every invalid product
+	var errs models.ValidationErrors
+	for i := range productReqs {
+		productReqs[i].Normalize()
+		if err := productReqs[i].Validate(); err != nil {
+			errs.Add(fmt.Sprintf("[%d]", i), err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return validationFailed(errs)
+	}
+
+	products, err := h.service.ImportProducts(productReqs)
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveProduct, err)
+		h.logger.Error(err.Error(), slog.Int("count", len(productReqs)), "error", err)
+		return internalError(errFailedToSaveProduct, err)
+	}
+	return c.JSON(http.StatusCreated, products)
+}
+
+// decodeProductsJSON reads products from a JSON array, one at a time so that it stops with
+// errTooManyProducts past maxImportedProducts.
+func decodeProductsJSON(r io.Reader) ([]models.ProductRequest, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('[') {
+		return nil, errors.New("expected a JSON array of products")
+	}
+
+	var productReqs []models.ProductRequest
+	for decoder.More() {
+		if len(productReqs) == maxImportedProducts {
+			return nil, errTooManyProducts
+		}
+		var productReq models.ProductRequest
+		if err := decoder.Decode(&productReq); err != nil {
+			return nil, err
+		}
+		productReqs = append(productReqs, productReq)
+	}
+	// Read the closing bracket, so that a truncated array is rejected
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return productReqs, nil
+}
+
+// decodeProductsCSV reads products from a CSV document whose first row names the columns.
+// It stops with errTooManyProducts past maxImportedProducts.
+func decodeProductsCSV(r io.Reader) ([]models.ProductRequest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"name", "price", "category"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing CSV column %q", name)
+		}
+	}
+
+	var productReqs []models.ProductRequest
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(productReqs) == maxImportedProducts {
+			return nil, errTooManyProducts
+		}
+
+		price, err := models.ParseMoney(record[columns["price"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price %q", line, record[columns["price"]])
+		}
+		productReqs = append(productReqs, models.ProductRequest{
+			Name:     record[columns["name"]],
+			Price:    price,
+			Category: record[columns["category"]],
+		})
+	}
+	return productReqs, nil
+}
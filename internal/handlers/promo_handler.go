@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Custom error definitions
+var errFailedToValidateCoupon = errors.New("failed to validate coupon")
+
+// PromoCodeHandler handles HTTP requests related to promo codes
+type PromoCodeHandler struct {
+	service *services.PromoCodeService
+	logger  *slog.Logger
+}
+
+// NewPromoCodeHandler creates a new PromoCodeHandler
+func NewPromoCodeHandler(service *services.PromoCodeService, logger *slog.Logger) *PromoCodeHandler {
+	return &PromoCodeHandler{service: service, logger: logger}
+}
+
+// RegisterPromoCodeRoutes sets up the routes for promo code-related endpoints
+func (h *PromoCodeHandler) RegisterPromoCodeRoutes(e *echo.Echo) {
+	e.GET("/coupons/status", h.GetCouponStatus)
+	e.POST("/coupons/validate", h.ValidateCoupon)
+}
+
+// ValidateCoupon handles the POST /coupons/validate request
+func (h *PromoCodeHandler) ValidateCoupon(c echo.Context) error {
+	var validationReq models.CouponValidationRequest
+
+	// Bind the request body to CouponValidationRequest
+	if err := c.Bind(&validationReq); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+	if err := validationReq.Validate(); err != nil {
+		return validationFailed(err)
+	}
+
+	quote, err := h.service.ValidatePromo(validationReq.Code, validationReq.Items, validationReq.Currency)
+	if errors.Is(err, services.ErrProductNotFound) || isCurrencyError(err) {
+		h.logger.Warn("Product does not exist", "error", err)
+		return err
+	}
+	if err != nil {
+		h.logger.Error("Failed to validate coupon", slog.String("code", validationReq.Code), "error", err)
+		return internalError(errFailedToValidateCoupon, err)
+	}
+
+	return c.JSON(http.StatusOK, quote)
+}
+
+// GetCouponStatus handles the GET /coupons/status request
+func (h *PromoCodeHandler) GetCouponStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.CouponStatus())
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Custom error definitions
+var (
+	errFailedToFetchTaxRules = errors.New("failed to fetch tax rules")
+	errFailedToSaveTaxRule   = errors.New("failed to save tax rule")
+	errTaxRuleNotFound       = errors.New("tax rule not found")
+)
+
+// TaxHandler handles HTTP requests related to tax rules
+type TaxHandler struct {
+	service *services.TaxService
+	logger  *slog.Logger
+}
+
+// NewTaxHandler creates a new TaxHandler
+func NewTaxHandler(service *services.TaxService, logger *slog.Logger) *TaxHandler {
+	return &TaxHandler{service: service, logger: logger}
+}
+
+// RegisterTaxRoutes sets up the routes for tax rule endpoints
+func (h *TaxHandler) RegisterTaxRoutes(e *echo.Echo) {
+	e.GET("/tax-rules", h.GetTaxRules)
+
+	// Tax rules are maintained by platform admins
+	e.PUT("/tax-rules/:category", h.SetTaxRule, middleware.RequirePermission(auth.PermManagePricing))
+	e.DELETE("/tax-rules/:category", h.DeleteTaxRule, middleware.RequirePermission(auth.PermManagePricing))
+}
+
+// GetTaxRules handles the GET /tax-rules request
+func (h *TaxHandler) GetTaxRules(c echo.Context) error {
+	rules, err := h.service.ListRules()
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToFetchTaxRules, err)
+		h.logger.Error(err.Error(), "error", err)
+		return internalError(errFailedToFetchTaxRules, err)
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// SetTaxRule handles the PUT /tax-rules/:category request.
+// The * category sets the rule of every category without one.
+func (h *TaxHandler) SetTaxRule(c echo.Context) error {
+	var rule models.TaxRule
+	if err := c.Bind(&rule); err != nil {
+		h.logger.Error("Invalid request payload", slog.String("error", err.Error()))
+		return invalidPayload("Invalid request payload", err)
+	}
+	rule.Category = c.Param("category")
+
+	saved, err := h.service.SetRule(rule)
+	if errors.Is(err, models.ErrInvalidTaxCategory) || errors.Is(err, models.ErrInvalidTaxRate) {
+		return validationFailed(err)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveTaxRule, err)
+		h.logger.Error(err.Error(), slog.String("category", rule.Category), "error", err)
+		return internalError(errFailedToSaveTaxRule, err)
+	}
+
+	h.logger.Info("Tax rule updated", slog.String("category", saved.Category), slog.String("by", middleware.Actor(c)))
+	return c.JSON(http.StatusOK, saved)
+}
+
+// DeleteTaxRule handles the DELETE /tax-rules/:category request
+func (h *TaxHandler) DeleteTaxRule(c echo.Context) error {
+	category := c.Param("category")
+	err := h.service.DeleteRule(category)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(errTaxRuleNotFound)
+	}
+	if err != nil {
+		err := fmt.Errorf("%w: %v", errFailedToSaveTaxRule, err)
+		h.logger.Error(err.Error(), slog.String("category", category), "error", err)
+		return internalError(errFailedToSaveTaxRule, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
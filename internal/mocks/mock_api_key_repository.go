@@ -0,0 +1,47 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"order_food_online/internal/models"
+	"time"
+)
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+// CreateAPIKey mocks the CreateAPIKey method of the repository
+func (m *MockAPIKeyRepository) CreateAPIKey(key models.APIKey) (*models.APIKey, error) {
+	args := m.Called(key)
+	if created, ok := args.Get(0).(*models.APIKey); ok {
+		return created, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListAPIKeys mocks the ListAPIKeys method of the repository
+func (m *MockAPIKeyRepository) ListAPIKeys() ([]models.APIKey, error) {
+	args := m.Called()
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+// GetAPIKeyByHash mocks the GetAPIKeyByHash method of the repository
+func (m *MockAPIKeyRepository) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	args := m.Called(keyHash)
+	if key, ok := args.Get(0).(*models.APIKey); ok {
+		return key, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// RevokeAPIKey mocks the RevokeAPIKey method of the repository
+func (m *MockAPIKeyRepository) RevokeAPIKey(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+// TouchAPIKey mocks the TouchAPIKey method of the repository
+func (m *MockAPIKeyRepository) TouchAPIKey(id int, usedAt time.Time) error {
+	args := m.Called(id, usedAt)
+	return args.Error(0)
+}
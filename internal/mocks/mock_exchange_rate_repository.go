@@ -0,0 +1,39 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"order_food_online/internal/models"
+)
+
+type MockExchangeRateRepository struct {
+	mock.Mock
+}
+
+// ListRates mocks the ListRates method of the repository
+func (m *MockExchangeRateRepository) ListRates() ([]models.ExchangeRate, error) {
+	args := m.Called()
+	return args.Get(0).([]models.ExchangeRate), args.Error(1)
+}
+
+// GetRate mocks the GetRate method of the repository
+func (m *MockExchangeRateRepository) GetRate(currency string) (*models.ExchangeRate, error) {
+	args := m.Called(currency)
+
+	// Handle nil return safely
+	if rate, ok := args.Get(0).(*models.ExchangeRate); ok {
+		return rate, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// SetRates mocks the SetRates method of the repository
+func (m *MockExchangeRateRepository) SetRates(rates map[string]models.Rate) error {
+	args := m.Called(rates)
+	return args.Error(0)
+}
+
+// DeleteRate mocks the DeleteRate method of the repository
+func (m *MockExchangeRateRepository) DeleteRate(currency string) error {
+	args := m.Called(currency)
+	return args.Error(0)
+}
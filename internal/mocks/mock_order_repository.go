@@ -3,6 +3,7 @@ package mocks
 import (
 	"github.com/stretchr/testify/mock"
 	"order_food_online/internal/models"
+	"time"
 )
 
 // MockOrderService is a mock implementation of the OrderService interface
@@ -11,8 +12,8 @@ type MockOrderService struct {
 }
 
 // PlaceOrder mocks the CreateOrder method
-func (m *MockOrderService) PlaceOrder(orderReq models.OrderRequest) (*models.Order, error) {
-	args := m.Called(orderReq)
+func (m *MockOrderService) PlaceOrder(orderReq models.OrderRequest, currency models.CurrencyConverter) (*models.Order, error) {
+	args := m.Called(orderReq, currency)
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
@@ -22,14 +23,37 @@ func (m *MockOrderService) GetOrderByID(id int) (*models.Order, error) {
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
-// GetAllOrders mocks the GetAllOrders method
-func (m *MockOrderService) GetAllOrders() ([]models.Order, error) {
-	args := m.Called()
-	return args.Get(0).([]models.Order), args.Error(1)
+// ListOrders mocks the ListOrders method
+func (m *MockOrderService) ListOrders(query models.OrderQuery) (*models.OrderPage, error) {
+	args := m.Called(query)
+	return args.Get(0).(*models.OrderPage), args.Error(1)
 }
 
-// CheckProductExists mocks the CheckProductExists method
-func (m *MockOrderService) CheckProductExists(productID int) (bool, error) {
-	args := m.Called(productID)
-	return args.Get(0).(bool), args.Error(1)
+// UpdateOrderStatus mocks the UpdateOrderStatus method
+func (m *MockOrderService) UpdateOrderStatus(id int, statusReq models.OrderStatusRequest, changedBy string) (*models.Order, error) {
+	args := m.Called(id, statusReq, changedBy)
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+// GetOrderStatusHistory mocks the GetOrderStatusHistory method
+func (m *MockOrderService) GetOrderStatusHistory(id int) ([]models.OrderStatusChange, error) {
+	args := m.Called(id)
+	return args.Get(0).([]models.OrderStatusChange), args.Error(1)
+}
+
+// CancelOrder mocks the CancelOrder method
+func (m *MockOrderService) CancelOrder(id int, cancelReq models.CancelOrderRequest, changedBy string, window time.Duration) (*models.Order, error) {
+	args := m.Called(id, cancelReq, changedBy, window)
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+// FindIdempotencyRecord mocks the FindIdempotencyRecord method
+func (m *MockOrderService) FindIdempotencyRecord(key string) (*models.IdempotencyRecord, error) {
+	args := m.Called(key)
+
+	// Handle nil return safely
+	if record, ok := args.Get(0).(*models.IdempotencyRecord); ok {
+		return record, args.Error(1)
+	}
+	return nil, args.Error(1)
 }
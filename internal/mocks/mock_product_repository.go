@@ -9,14 +9,60 @@ type MockProductRepository struct {
 	mock.Mock
 }
 
-// GetAllProducts mocks the GetAllProducts method of the repository
-func (m *MockProductRepository) GetAllProducts() ([]models.Product, error) {
-	args := m.Called()
-	return args.Get(0).([]models.Product), args.Error(1)
+// ListProducts mocks the ListProducts method of the repository
+func (m *MockProductRepository) ListProducts(query models.ProductQuery) (*models.ProductPage, error) {
+	args := m.Called(query)
+	return args.Get(0).(*models.ProductPage), args.Error(1)
 }
 
 // GetProductByID mocks the GetProductById method of the repository
 func (m *MockProductRepository) GetProductByID(id int) (*models.Product, error) {
 	args := m.Called(id)
+
+	// Handle nil return safely
+	if product, ok := args.Get(0).(*models.Product); ok {
+		return product, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetProductsByIDs mocks the GetProductsByIDs method of the repository. The return value can
+// be a func([]int) []models.Product, to serve a catalog whatever the IDs asked for.
+func (m *MockProductRepository) GetProductsByIDs(ids []int) ([]models.Product, error) {
+	args := m.Called(ids)
+	if catalog, ok := args.Get(0).(func([]int) []models.Product); ok {
+		return catalog(ids), args.Error(1)
+	}
+	products, _ := args.Get(0).([]models.Product)
+	return products, args.Error(1)
+}
+
+// CreateProduct mocks the CreateProduct method of the repository
+func (m *MockProductRepository) CreateProduct(productReq models.ProductRequest) (*models.Product, error) {
+	args := m.Called(productReq)
+	return args.Get(0).(*models.Product), args.Error(1)
+}
+
+// UpdateProduct mocks the UpdateProduct method of the repository
+func (m *MockProductRepository) UpdateProduct(id int, productReq models.ProductRequest) (*models.Product, error) {
+	args := m.Called(id, productReq)
 	return args.Get(0).(*models.Product), args.Error(1)
 }
+
+// SetStock mocks the SetStock method of the repository
+func (m *MockProductRepository) SetStock(id int, stockReq models.StockRequest) (*models.Product, error) {
+	args := m.Called(id, stockReq)
+	return args.Get(0).(*models.Product), args.Error(1)
+}
+
+// DeleteProduct mocks the DeleteProduct method of the repository
+func (m *MockProductRepository) DeleteProduct(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+// ImportProducts mocks the ImportProducts method of the repository
+func (m *MockProductRepository) ImportProducts(productReqs []models.ProductRequest) ([]models.Product, error) {
+	args := m.Called(productReqs)
+	return args.Get(0).([]models.Product), args.Error(1)
+}
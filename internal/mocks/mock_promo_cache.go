@@ -24,3 +24,8 @@ func (m *MockPromoCodeCache) SetPromoCode(code string, PromoCode *models.PromoCo
 	args := m.Called(code, PromoCode, ttl)
 	return args.Error(0)
 }
+
+func (m *MockPromoCodeCache) DeletePromoCodes(codes []string) error {
+	args := m.Called(codes)
+	return args.Error(0)
+}
@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"order_food_online/internal/models"
+)
+
+type MockPromoCodeRepository struct {
+	mock.Mock
+}
+
+// GetPromoCode mocks the GetPromoCode method of the repository
+func (m *MockPromoCodeRepository) GetPromoCode(code string) (*models.PromoCode, error) {
+	args := m.Called(code)
+
+	// Handle nil return safely
+	if promoCode, ok := args.Get(0).(*models.PromoCode); ok {
+		return promoCode, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
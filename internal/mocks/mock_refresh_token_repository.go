@@ -0,0 +1,31 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"order_food_online/internal/models"
+)
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+// CreateRefreshToken mocks the CreateRefreshToken method of the repository
+func (m *MockRefreshTokenRepository) CreateRefreshToken(token models.RefreshToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+// RotateRefreshToken mocks the RotateRefreshToken method of the repository
+func (m *MockRefreshTokenRepository) RotateRefreshToken(tokenHash string, next models.RefreshToken) (*models.RefreshToken, error) {
+	args := m.Called(tokenHash, next)
+	if rotated, ok := args.Get(0).(*models.RefreshToken); ok {
+		return rotated, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// RevokeRefreshTokenFamily mocks the RevokeRefreshTokenFamily method of the repository
+func (m *MockRefreshTokenRepository) RevokeRefreshTokenFamily(tokenHash string) error {
+	args := m.Called(tokenHash)
+	return args.Error(0)
+}
@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"order_food_online/internal/models"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+// CreateUser mocks the CreateUser method of the repository
+func (m *MockUserRepository) CreateUser(user models.User) (*models.User, error) {
+	args := m.Called(user)
+	if created, ok := args.Get(0).(*models.User); ok {
+		return created, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetUserByEmail mocks the GetUserByEmail method of the repository
+func (m *MockUserRepository) GetUserByEmail(email string) (*models.User, error) {
+	args := m.Called(email)
+	if user, ok := args.Get(0).(*models.User); ok {
+		return user, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetUserByID mocks the GetUserByID method of the repository
+func (m *MockUserRepository) GetUserByID(id int) (*models.User, error) {
+	args := m.Called(id)
+	if user, ok := args.Get(0).(*models.User); ok {
+		return user, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// SetUserRole mocks the SetUserRole method of the repository
+func (m *MockUserRepository) SetUserRole(id int, role string) (*models.User, error) {
+	args := m.Called(id, role)
+	if user, ok := args.Get(0).(*models.User); ok {
+		return user, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GrantFirstRole mocks the GrantFirstRole method of the repository
+func (m *MockUserRepository) GrantFirstRole(id int, role string) (bool, error) {
+	args := m.Called(id, role)
+	return args.Bool(0), args.Error(1)
+}
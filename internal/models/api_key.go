@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/guregu/null"
+)
+
+// APIKey is a key partners authenticate with instead of a bearer token. It grants the
+// permissions listed in its scopes.
+type APIKey struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"` // first characters of the key, to tell keys apart
+	Scopes     []string  `json:"scopes"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  null.Time `json:"expires_at"`
+	LastUsedAt null.Time `json:"last_used_at"`
+	RevokedAt  null.Time `json:"revoked_at"`
+	KeyHash    string    `json:"-"`
+}
+
+// Active reports whether the key can still be used at the given time.
+func (k *APIKey) Active(now time.Time) bool {
+	return !k.RevokedAt.Valid && (!k.ExpiresAt.Valid || now.Before(k.ExpiresAt.Time))
+}
+
+// CreateAPIKeyRequest creates an API key.
+type CreateAPIKeyRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt null.Time `json:"expires_at"` // never expires when null
+}
+
+// CreatedAPIKey is an API key along with its secret, which is only returned when it is created.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
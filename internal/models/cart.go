@@ -0,0 +1,190 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cart is a shopping cart kept between requests. It only records what the customer picked:
+// prices are worked out from the catalog every time the cart is shown.
+type Cart struct {
+	Items      []CartItem `json:"items"`
+	CouponCode string     `json:"coupon_code,omitempty"`
+
+	// Revision changes every time the cart does, so checking out the same cart twice
+	// places a single order
+	Revision  string    `json:"revision"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CartItem is a line of a cart.
+type CartItem struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// CartOwner identifies a cart: the one of a customer account, or the one of an anonymous
+// visitor, known by the guest ID the API handed out.
+type CartOwner struct {
+	UserID  int
+	GuestID string
+	// APIKeyID is the partner API key a guest cart is used with, if any. It is not part of the
+	// cart's identity, but orders placed from the cart belong to the key.
+	APIKeyID int
+}
+
+// IsZero reports whether the owner names no cart.
+func (o CartOwner) IsZero() bool {
+	return o.UserID == 0 && o.GuestID == ""
+}
+
+// Key names the cart of the owner in storage.
+func (o CartOwner) Key() string {
+	if o.UserID != 0 {
+		return "user:" + strconv.Itoa(o.UserID)
+	}
+	return "guest:" + o.GuestID
+}
+
+// guestIDLength is the length of the hex encoded guest IDs
+const guestIDLength = 32
+
+// IsGuestID reports whether id has the shape of the guest IDs the API hands out.
+func IsGuestID(id string) bool {
+	if len(id) != guestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// CartItemRequest adds a product to a cart, or sets the quantity of a line when the
+// product is given in the path.
+type CartItemRequest struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// Validate checks the request orders a valid quantity of a product.
+func (r *CartItemRequest) Validate() error {
+	var errs ValidationErrors
+	if r.ProductID <= 0 {
+		errs.Add("product_id", "must be a positive product ID")
+	}
+	if r.Quantity < 1 || r.Quantity > MaxItemQuantity {
+		errs.Add("quantity", fmt.Sprintf("must be between 1 and %d", MaxItemQuantity))
+	}
+	return errs.Err()
+}
+
+// CartCouponRequest applies a coupon to a cart.
+type CartCouponRequest struct {
+	Code string `json:"code"`
+}
+
+// AddItem adds quantity units of a product, to the line of the product if there is one.
+func (c *Cart) AddItem(productID, quantity int) error {
+	for i, item := range c.Items {
+		if item.ProductID != productID {
+			continue
+		}
+		if item.Quantity+quantity > MaxItemQuantity {
+			return ValidationErrors{{Field: "quantity", Message: fmt.Sprintf(
+				"must add up to at most %d with the %d already in the cart", MaxItemQuantity, item.Quantity)}}
+		}
+		c.Items[i].Quantity += quantity
+		return nil
+	}
+	if len(c.Items) >= MaxOrderItems {
+		return ValidationErrors{{Field: "product_id", Message: fmt.Sprintf("cart already holds %d products", MaxOrderItems)}}
+	}
+	c.Items = append(c.Items, CartItem{ProductID: productID, Quantity: quantity})
+	return nil
+}
+
+// SetQuantity sets the quantity of the line of a product. It reports false when the cart
+// has no such line.
+func (c *Cart) SetQuantity(productID, quantity int) bool {
+	for i, item := range c.Items {
+		if item.ProductID == productID {
+			c.Items[i].Quantity = quantity
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveItem removes the line of a product. It reports false when the cart has no such line.
+func (c *Cart) RemoveItem(productID int) bool {
+	for i, item := range c.Items {
+		if item.ProductID == productID {
+			c.Items = append(c.Items[:i], c.Items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Merge adds the lines of another cart to this one, within the limits on the size of an
+// order. The coupon of this cart is kept, if it has one.
+func (c *Cart) Merge(other *Cart) {
+	for _, item := range other.Items {
+		merged := false
+		for i := range c.Items {
+			if c.Items[i].ProductID == item.ProductID {
+				c.Items[i].Quantity += item.Quantity
+				if c.Items[i].Quantity > MaxItemQuantity {
+					c.Items[i].Quantity = MaxItemQuantity
+				}
+				merged = true
+				break
+			}
+		}
+		if !merged && len(c.Items) < MaxOrderItems {
+			c.Items = append(c.Items, item)
+		}
+	}
+	if c.CouponCode == "" {
+		c.CouponCode = other.CouponCode
+	}
+}
+
+// OrderItems returns the lines of the cart as order items.
+func (c *Cart) OrderItems() []OrderItem {
+	items := make([]OrderItem, 0, len(c.Items))
+	for _, item := range c.Items {
+		items = append(items, OrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	return items
+}
+
+// CartView is a cart priced at current catalog prices.
+type CartView struct {
+	GuestID    string       `json:"guest_id,omitempty"` // for anonymous carts, to send back in the X-Cart-ID header
+	Items      []CartLine   `json:"items"`
+	CouponCode string       `json:"coupon_code,omitempty"`
+	Coupon     *CouponQuote `json:"coupon,omitempty"` // how the coupon applies to the cart as it is now
+	Subtotal   Money        `json:"subtotal"`
+	Discount   Money        `json:"discount"`
+	Total      Money        `json:"total"`
+	Currency   string       `json:"currency"`
+	Revision   string       `json:"revision,omitempty"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// CartLine is a priced line of a cart. Available is false for products that can't be ordered
+// anymore, because they sold out or left the catalog; they are not part of the subtotal.
+type CartLine struct {
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Price       Money  `json:"price"`
+	LineTotal   Money  `json:"line_total"`
+	Available   bool   `json:"available"`
+}
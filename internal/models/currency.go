@@ -0,0 +1,253 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCurrency     = errors.New("currency must be a 3-letter ISO 4217 code")
+	ErrUnsupportedCurrency = errors.New("no exchange rate for currency")
+	ErrInvalidRate         = errors.New("exchange rate must be positive with at most 6 decimals")
+)
+
+// NormalizeCurrency uppercases and trims a currency code.
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidateCurrency checks a normalized currency code looks like an ISO 4217 code.
+func ValidateCurrency(code string) error {
+	if len(code) != 3 {
+		return ErrInvalidCurrency
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return ErrInvalidCurrency
+		}
+	}
+	return nil
+}
+
+// rateScale is the number of decimals kept for exchange rates
+const rateScale = 6
+
+// Rate is an exchange rate in millionths, so conversions stay exact.
+type Rate int64
+
+// OneRate converts the base currency into itself.
+const OneRate Rate = 1000000
+
+// ParseRate parses a positive decimal rate such as "0.92" or "151.234".
+func ParseRate(s string) (Rate, error) {
+	value, ok := parseDecimal(s, rateScale)
+	if !ok || value <= 0 {
+		return 0, ErrInvalidRate
+	}
+	return Rate(value), nil
+}
+
+// String formats the rate with six decimals.
+func (r Rate) String() string {
+	return formatDecimal(int64(r), rateScale)
+}
+
+// MarshalJSON writes the rate as a JSON number.
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON reads the rate from a JSON number or string.
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseRate(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Scan reads a NUMERIC column.
+func (r *Rate) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("cannot scan %T into Rate", src)
+	}
+	parsed, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Value writes the rate as a decimal string.
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// ExchangeRate is how many units of Currency one unit of the base currency buys.
+type ExchangeRate struct {
+	Currency  string    `json:"currency"`
+	Rate      Rate      `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExchangeRatesRequest sets the rates of several currencies at once.
+// Local rate files use the same format.
+type ExchangeRatesRequest struct {
+	Rates map[string]Rate `json:"rates"`
+}
+
+// Normalize uppercases the currency codes.
+func (r *ExchangeRatesRequest) Normalize() {
+	rates := make(map[string]Rate, len(r.Rates))
+	for currency, rate := range r.Rates {
+		rates[NormalizeCurrency(currency)] = rate
+	}
+	r.Rates = rates
+}
+
+// Validate checks every currency code and rate.
+func (r *ExchangeRatesRequest) Validate() error {
+	for currency, rate := range r.Rates {
+		if err := ValidateCurrency(currency); err != nil {
+			return err
+		}
+		if rate <= 0 {
+			return ErrInvalidRate
+		}
+	}
+	return nil
+}
+
+// ExchangeRateTable lists the rates against the base currency.
+type ExchangeRateTable struct {
+	Base  string         `json:"base"`
+	Rates []ExchangeRate `json:"rates"`
+}
+
+// Prices maps ISO currency codes to native prices. It is stored as a JSON object.
+type Prices map[string]Money
+
+// Scan reads the JSON object built by json_object_agg.
+func (p *Prices) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*p = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Prices", src)
+	}
+	prices := Prices{}
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return err
+	}
+	if len(prices) == 0 {
+		prices = nil
+	}
+	*p = prices
+	return nil
+}
+
+// CurrencyConverter converts catalog amounts, kept in the base currency, into the currency an
+// order is paid in. Rate is zero when the currency has no exchange rate: only native prices
+// can then be given in it.
+type CurrencyConverter struct {
+	Currency string
+	Rate     Rate
+}
+
+// HasRate reports whether base amounts can be converted into the currency.
+func (c CurrencyConverter) HasRate() bool {
+	return c.Rate > 0
+}
+
+// Convert converts an amount from the base currency, rounding half away from zero to the cent.
+// The converter must have a rate.
+func (c CurrencyConverter) Convert(m Money) Money {
+	return Money(mulDiv(int64(m), int64(c.Rate), int64(OneRate)))
+}
+
+// ConvertBack converts an amount into the base currency. The converter must have a rate.
+func (c CurrencyConverter) ConvertBack(m Money) Money {
+	return Money(mulDiv(int64(m), int64(OneRate), int64(c.Rate)))
+}
+
+// Price returns a product's price in the currency: its native price when it has one,
+// otherwise its base price converted at the exchange rate. It fails with
+// ErrUnsupportedCurrency when the price needs a rate the currency doesn't have.
+func (c CurrencyConverter) Price(basePrice Money, native NullMoney) (Money, error) {
+	if native.Valid {
+		return native.Money, nil
+	}
+	if !c.HasRate() {
+		return 0, c.missingRate()
+	}
+	return c.Convert(basePrice), nil
+}
+
+// Product returns a copy of the product priced in the currency.
+func (c CurrencyConverter) Product(p Product) (Product, error) {
+	native, ok := p.Prices[c.Currency]
+	price, err := c.Price(p.Price, NullMoney{Money: native, Valid: ok})
+	if err != nil {
+		return Product{}, err
+	}
+	p.Price = price
+	p.Currency = c.Currency
+	return p, nil
+}
+
+// PromoCode returns a copy of the promo code with its amounts in the currency.
+// Percentages are left untouched, so a percentage coupon without a cap or a minimum order
+// needs no rate.
+func (c CurrencyConverter) PromoCode(p PromoCode) (PromoCode, error) {
+	amounts := []*Money{&p.MaxDiscount, &p.MinOrderValue}
+	if p.DiscountType == DiscountFixed {
+		amounts = append(amounts, &p.DiscountValue)
+	}
+	for _, amount := range amounts {
+		if *amount == 0 {
+			continue
+		}
+		if !c.HasRate() {
+			return PromoCode{}, c.missingRate()
+		}
+		*amount = c.Convert(*amount)
+	}
+	return p, nil
+}
+
+func (c CurrencyConverter) missingRate() error {
+	return fmt.Errorf("%w %s", ErrUnsupportedCurrency, c.Currency)
+}
+
+// mulDiv returns a*b/c rounded half away from zero, without overflowing in between.
+func mulDiv(a, b, c int64) int64 {
+	product := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	quotient, remainder := new(big.Int).QuoRem(product, big.NewInt(c), new(big.Int))
+	if remainder.Abs(remainder).Mul(remainder, big.NewInt(2)).Cmp(big.NewInt(c)) >= 0 {
+		if product.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient.Int64()
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidMoney = errors.New("amount must be a decimal number with at most 2 decimals")
+
+// Money is an amount in cents. Keeping amounts as integers makes sums and
+// products exact; it is read and written as a decimal with two places.
+type Money int64
+
+// ParseMoney parses a decimal amount such as "12", "12.5" or "-0.99".
+func ParseMoney(s string) (Money, error) {
+	cents, ok := parseDecimal(s, 2)
+	if !ok {
+		return 0, ErrInvalidMoney
+	}
+	return Money(cents), nil
+}
+
+// String formats the amount with two decimals, e.g. "12.50".
+func (m Money) String() string {
+	return formatDecimal(int64(m), 2)
+}
+
+// Mul returns the amount multiplied by a quantity.
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percent returns pct percent of the amount, rounded half away from zero to the cent.
+// pct is itself expressed with two decimals, so 1250 is 12.50%.
+func (m Money) Percent(pct Money) Money {
+	product := int64(m) * int64(pct)
+	if product < 0 {
+		return -Money((-product + 5000) / 10000)
+	}
+	return Money((product + 5000) / 10000)
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimals.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads the amount from a JSON number or string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	parsed, err := ParseMoney(strings.Trim(text, `"`))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalText reads the amount from a query parameter.
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseMoney(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a NUMERIC column.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return m.UnmarshalText(v)
+	case string:
+		return m.UnmarshalText([]byte(v))
+	case int64:
+		*m = Money(v * 100)
+		return nil
+	case nil:
+		return errors.New("cannot scan NULL into Money")
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+// Value writes the amount as a decimal string, which Postgres casts to NUMERIC without loss.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// NullMoney is an amount that may be missing.
+type NullMoney struct {
+	Money Money
+	Valid bool
+}
+
+// NewNullMoney returns a valid NullMoney.
+func NewNullMoney(m Money) NullMoney {
+	return NullMoney{Money: m, Valid: true}
+}
+
+// MarshalJSON writes null when the amount is missing.
+func (n NullMoney) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return n.Money.MarshalJSON()
+}
+
+// UnmarshalJSON reads an amount or null.
+func (n *NullMoney) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*n = NullMoney{}
+		return nil
+	}
+	if err := n.Money.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// UnmarshalText reads an amount from a query parameter, an empty value meaning missing.
+func (n *NullMoney) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*n = NullMoney{}
+		return nil
+	}
+	if err := n.Money.UnmarshalText(text); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Scan reads a nullable NUMERIC column.
+func (n *NullMoney) Scan(src interface{}) error {
+	if src == nil {
+		*n = NullMoney{}
+		return nil
+	}
+	if err := n.Money.Scan(src); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Value writes NULL when the amount is missing.
+func (n NullMoney) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Money.Value()
+}
+
+// parseDecimal parses a decimal number with at most the given number of decimals
+// into an integer scaled by 10^places.
+func parseDecimal(s string, places int) (int64, bool) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || len(fraction) > places {
+		return 0, false
+	}
+	fraction += strings.Repeat("0", places-len(fraction))
+	if whole == "" {
+		whole = "0"
+	}
+	// Reject signs, spaces and exponents ParseInt would otherwise accept or complain about less clearly
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+
+	value, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		value = -value
+	}
+	return value, true
+}
+
+// formatDecimal formats an integer scaled by 10^places as a decimal number.
+func formatDecimal(value int64, places int) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	digits := fmt.Sprintf("%0*d", places+1, value)
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
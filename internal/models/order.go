@@ -1,22 +1,218 @@
 package models
 
-import "github.com/guregu/null/zero"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/guregu/null"
+	"github.com/guregu/null/zero"
+)
+
+var (
+	ErrInvalidOrderDateRange = errors.New("from must be before to")
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must be between 1 and 255 printable characters")
+)
+
+// ValidateIdempotencyKey checks a client supplied idempotency key fits the orders table.
+func ValidateIdempotencyKey(key string) error {
+	if key == "" || len(key) > 255 {
+		return ErrInvalidIdempotencyKey
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return ErrInvalidIdempotencyKey
+		}
+	}
+	return nil
+}
 
 type OrderRequest struct {
 	CouponCode zero.String `json:"coupon_code"`
 	Items      []OrderItem `json:"items"`
+	Currency   string      `json:"currency"`
+
+	// CustomerID and APIKeyID identify who places the order; they are never read from the
+	// request body
+	CustomerID zero.Int `json:"-"`
+	APIKeyID   zero.Int `json:"-"`
+	// IdempotencyKey lets clients retry a request without placing the order twice
+	IdempotencyKey string `json:"-"`
+}
+
+// Limits on the size of a single order
+const (
+	MaxOrderItems   = 50
+	MaxItemQuantity = 100
+)
+
+// Normalize uppercases the currency code.
+func (r *OrderRequest) Normalize() {
+	r.Currency = NormalizeCurrency(r.Currency)
+}
+
+// Validate checks every line of the order and reports all the rejected fields at once.
+func (r *OrderRequest) Validate() error {
+	var errs ValidationErrors
+	switch {
+	case len(r.Items) == 0:
+		errs.Add("items", "must contain at least one item")
+	case len(r.Items) > MaxOrderItems:
+		errs.Add("items", fmt.Sprintf("must contain at most %d items", MaxOrderItems))
+	}
+
+	// Lines ordering the same product are merged, so their quantities must add up to a valid one
+	quantities := make(map[int]int, len(r.Items))
+	for i, item := range r.Items {
+		if item.ProductID <= 0 {
+			errs.Add(fmt.Sprintf("items[%d].product_id", i), "must be a positive product ID")
+		}
+		if item.Quantity < 1 || item.Quantity > MaxItemQuantity {
+			errs.Add(fmt.Sprintf("items[%d].quantity", i), fmt.Sprintf("must be between 1 and %d", MaxItemQuantity))
+			continue
+		}
+		quantities[item.ProductID] += item.Quantity
+		if quantities[item.ProductID] > MaxItemQuantity && quantities[item.ProductID]-item.Quantity <= MaxItemQuantity {
+			errs.Add(fmt.Sprintf("items[%d].quantity", i),
+				fmt.Sprintf("must add up to at most %d with the other lines for product %d", MaxItemQuantity, item.ProductID))
+		}
+	}
+
+	if r.Currency != "" {
+		if err := ValidateCurrency(r.Currency); err != nil {
+			errs.Add("currency", err.Error())
+		}
+	}
+	return errs.Err()
+}
+
+// MergeItems combines the lines ordering the same product into the first of them,
+// adding up their quantities.
+func (r *OrderRequest) MergeItems() {
+	lines := make(map[int]int, len(r.Items))
+	merged := make([]OrderItem, 0, len(r.Items))
+	for _, item := range r.Items {
+		if i, ok := lines[item.ProductID]; ok {
+			merged[i].Quantity += item.Quantity
+			continue
+		}
+		lines[item.ProductID] = len(merged)
+		merged = append(merged, item)
+	}
+	r.Items = merged
+}
+
+// Fingerprint identifies the content of the request, so retries can be told apart from key reuse.
+func (r OrderRequest) Fingerprint() string {
+	data, _ := json.Marshal(struct {
+		CouponCode string      `json:"coupon_code"`
+		Items      []OrderItem `json:"items"`
+		Currency   string      `json:"currency"`
+		CustomerID int64       `json:"customer_id"`
+		APIKeyID   int64       `json:"api_key_id,omitempty"`
+	}{r.CouponCode.String, r.Items, r.Currency, r.CustomerID.Int64, r.APIKeyID.Int64})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// IdempotencyRecord links an idempotency key to the order it created.
+type IdempotencyRecord struct {
+	OrderID     int    `json:"order_id"`
+	RequestHash string `json:"request_hash"`
 }
 
 type OrderItem struct {
-	ProductID int     `json:"product_id"`
-	OrderID   int     `json:"order_id"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	OrderID     int    `json:"order_id"`
+	Quantity    int    `json:"quantity"`
+	Price       Money  `json:"price"`
+
+	// Tax breakdown of the line, once the order is placed
+	Discount     Money `json:"discount"`
+	TaxRate      Money `json:"tax_rate"`
+	TaxInclusive bool  `json:"tax_inclusive"`
+	Net          Money `json:"net"`
+	Tax          Money `json:"tax"`
+	Gross        Money `json:"gross"`
+
+	// StockReserved tells whether the quantity was taken from the product's stock
+	StockReserved bool `json:"-"`
 }
 
 type Order struct {
-	ID         int         `json:"id"`
-	CouponCode string      `json:"coupon_code"`
-	Items      []OrderItem `json:"items"`
-	FinalPrice float64     `json:"final_price"`
+	ID         int          `json:"id"`
+	CustomerID null.Int     `json:"customer_id"` // null for orders placed without logging in
+	APIKeyID   null.Int     `json:"api_key_id"`  // the partner API key the order was placed with, if any
+	CouponCode string       `json:"coupon_code"`
+	Items      []OrderItem  `json:"items"`
+	Subtotal   Money        `json:"subtotal"`
+	Discount   Money        `json:"discount"`
+	Net        Money        `json:"net"`
+	Tax        Money        `json:"tax"`
+	FinalPrice Money        `json:"final_price"` // gross amount the customer pays
+	Taxes      []TaxSummary `json:"taxes"`
+	Currency   string       `json:"currency"`
+	Status     OrderStatus  `json:"status"`
+	CreatedAt  time.Time    `json:"created_at"`
+
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+}
+
+// Subtotal returns the sum of price times quantity over the given items.
+func Subtotal(items []OrderItem) Money {
+	var subtotal Money
+	for _, item := range items {
+		subtotal += item.Price.Mul(item.Quantity)
+	}
+	return subtotal
+}
+
+// OrderQuery selects a page of orders, most recent first.
+type OrderQuery struct {
+	Cursor     string
+	Limit      int
+	From       null.Time // inclusive lower bound on the creation time
+	To         null.Time // exclusive upper bound on the creation time
+	CouponCode string
+	Status     OrderStatus
+	Currency   string
+	CustomerID int // restricts the page to the orders of a customer when set
+	APIKeyID   int // restricts the page to the orders placed with a partner API key when set
+}
+
+// Normalize applies defaults to the query.
+func (q *OrderQuery) Normalize() {
+	q.Limit = PageSize(q.Limit)
+	q.Currency = NormalizeCurrency(q.Currency)
+}
+
+// Validate checks the query describes a non-empty date range and a known status.
+func (q *OrderQuery) Validate() error {
+	if q.Status != "" && !q.Status.IsValid() {
+		return ErrInvalidOrderStatus
+	}
+	if q.Currency != "" {
+		if err := ValidateCurrency(q.Currency); err != nil {
+			return err
+		}
+	}
+	if q.From.Valid && q.To.Valid && !q.From.Time.Before(q.To.Time) {
+		return ErrInvalidOrderDateRange
+	}
+	return nil
+}
+
+// OrderCursor is the position of the last order of a page.
+type OrderCursor struct {
+	ID int `json:"id"`
+}
+
+// OrderPage is a page of orders.
+type OrderPage struct {
+	Items      []Order `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
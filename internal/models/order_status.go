@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidOrderStatus = errors.New("invalid order status")
+
+type OrderStatus string
+
+const (
+	OrderStatusPending        OrderStatus = "pending"
+	OrderStatusConfirmed      OrderStatus = "confirmed"
+	OrderStatusPreparing      OrderStatus = "preparing"
+	OrderStatusReady          OrderStatus = "ready"
+	OrderStatusOutForDelivery OrderStatus = "out_for_delivery"
+	OrderStatusDelivered      OrderStatus = "delivered"
+	OrderStatusCancelled      OrderStatus = "cancelled"
+	OrderStatusRefunded       OrderStatus = "refunded"
+)
+
+// orderStatusTransitions lists the statuses each status may move to
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:        {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed:      {OrderStatusPreparing, OrderStatusCancelled},
+	OrderStatusPreparing:      {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:          {OrderStatusOutForDelivery, OrderStatusDelivered, OrderStatusCancelled},
+	OrderStatusOutForDelivery: {OrderStatusDelivered},
+	OrderStatusDelivered:      {OrderStatusRefunded},
+	OrderStatusCancelled:      {OrderStatusRefunded},
+	OrderStatusRefunded:       {},
+}
+
+// IsValid reports whether s is a known order status.
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an order may move from s to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CanBeCancelledByCustomer reports whether a customer may still cancel an order at time now:
+// either the kitchen has not accepted it yet, or it was placed less than window ago.
+func (o *Order) CanBeCancelledByCustomer(now time.Time, window time.Duration) bool {
+	if !o.Status.CanTransitionTo(OrderStatusCancelled) {
+		return false
+	}
+	return o.Status == OrderStatusPending || now.Sub(o.CreatedAt) <= window
+}
+
+// CancelOrderRequest explains why a customer cancels an order.
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+// OrderStatusRequest asks to move an order to a new status.
+type OrderStatusRequest struct {
+	Status OrderStatus `json:"status"`
+	Note   string      `json:"note"`
+}
+
+// OrderStatusChange records a status transition of an order.
+type OrderStatusChange struct {
+	OrderID    int         `json:"order_id"`
+	FromStatus OrderStatus `json:"from_status"`
+	ToStatus   OrderStatus `json:"to_status"`
+	ChangedBy  string      `json:"changed_by"`
+	Note       string      `json:"note"`
+	ChangedAt  time.Time   `json:"changed_at"`
+}
@@ -1,8 +1,171 @@
 package models
 
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/guregu/null"
+)
+
+// Largest price a NUMERIC(10, 2) column can hold
+const maxProductPrice Money = 9999999999
+
+var (
+	ErrInvalidProductName     = errors.New("name must be between 1 and 255 characters")
+	ErrInvalidProductPrice    = errors.New("price must be positive, below 100000000 and have at most 2 decimals")
+	ErrInvalidProductCategory = errors.New("category must be between 1 and 50 characters")
+	ErrInvalidProductSort     = errors.New("sort must be one of id, name, -name, price, -price")
+	ErrInvalidProductStock    = errors.New("stock must be between 0 and 2147483647")
+)
+
+// Product list sort orders
+const (
+	ProductSortID        = "id"
+	ProductSortName      = "name"
+	ProductSortNameDesc  = "-name"
+	ProductSortPrice     = "price"
+	ProductSortPriceDesc = "-price"
+)
+
 type Product struct {
-	ID       int     `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	Category string  `json:"category"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Price    Money  `json:"price"`
+	Currency string `json:"currency,omitempty"`
+	Category string `json:"category"`
+
+	// Prices holds native prices in other currencies, which take precedence over converted ones
+	Prices Prices `json:"prices,omitempty"`
+
+	// Stock is the number of units left, null when the product is not stock-tracked.
+	// Available is false once the product is sold out or switched off by the kitchen.
+	Stock     null.Int `json:"stock"`
+	Available bool     `json:"available"`
+}
+
+// CanOrder reports whether quantity units of the product can be ordered.
+func (p *Product) CanOrder(quantity int) bool {
+	return p.Available && (!p.Stock.Valid || p.Stock.Int64 >= int64(quantity))
+}
+
+// StockRequest sets the stock of a product. A null stock stops tracking it;
+// available defaults to true.
+type StockRequest struct {
+	Stock     null.Int  `json:"stock"`
+	Available null.Bool `json:"available"`
+}
+
+// Normalize applies defaults to the request.
+func (r *StockRequest) Normalize() {
+	if !r.Available.Valid {
+		r.Available = null.BoolFrom(true)
+	}
+}
+
+// Validate checks the stock level is not negative.
+func (r *StockRequest) Validate() error {
+	if r.Stock.Valid && (r.Stock.Int64 < 0 || r.Stock.Int64 > math.MaxInt32) {
+		return ErrInvalidProductStock
+	}
+	return nil
+}
+
+// ProductRequest holds the editable fields of a product.
+type ProductRequest struct {
+	Name     string `json:"name"`
+	Price    Money  `json:"price"`
+	Category string `json:"category"`
+	Prices   Prices `json:"prices,omitempty"`
+}
+
+// Normalize trims surrounding whitespace, lowercases the category and uppercases currency codes.
+func (r *ProductRequest) Normalize() {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Category = strings.ToLower(strings.TrimSpace(r.Category))
+	if r.Prices != nil {
+		prices := make(Prices, len(r.Prices))
+		for currency, price := range r.Prices {
+			prices[NormalizeCurrency(currency)] = price
+		}
+		r.Prices = prices
+	}
+}
+
+// Validate checks the request fits the products table.
+func (r *ProductRequest) Validate() error {
+	if r.Name == "" || len(r.Name) > 255 {
+		return ErrInvalidProductName
+	}
+	if r.Price <= 0 || r.Price > maxProductPrice {
+		return ErrInvalidProductPrice
+	}
+	if r.Category == "" || len(r.Category) > 50 {
+		return ErrInvalidProductCategory
+	}
+	for currency, price := range r.Prices {
+		if err := ValidateCurrency(currency); err != nil {
+			return err
+		}
+		if price <= 0 || price > maxProductPrice {
+			return ErrInvalidProductPrice
+		}
+	}
+	return nil
+}
+
+// ProductQuery selects a page of the product catalog.
+type ProductQuery struct {
+	Cursor   string    `json:"cursor,omitempty"`
+	Limit    int       `json:"limit"`
+	Category string    `json:"category,omitempty"`
+	MinPrice NullMoney `json:"min_price"`
+	MaxPrice NullMoney `json:"max_price"`
+	Search   string    `json:"q,omitempty"`
+	Sort     string    `json:"sort"`
+
+	// Currency prices the page; price filters are given in it too
+	Currency string `json:"-"`
+	// PriceCurrency and PriceRate are the currency prices are filtered and sorted in, and its
+	// exchange rate: both apply to the prices shown in that currency, native prices included.
+	// PriceRate is zero when the currency has no rate, and only native prices are known
+	PriceCurrency string `json:"price_currency,omitempty"`
+	PriceRate     Rate   `json:"price_rate,omitempty"`
+}
+
+// Normalize applies defaults so equivalent queries look the same.
+func (q *ProductQuery) Normalize() {
+	q.Limit = PageSize(q.Limit)
+	q.Category = strings.ToLower(strings.TrimSpace(q.Category))
+	q.Search = strings.TrimSpace(q.Search)
+	if q.Sort == "" {
+		q.Sort = ProductSortID
+	}
+}
+
+// Validate checks the query only uses supported options.
+func (q *ProductQuery) Validate() error {
+	switch q.Sort {
+	case ProductSortID, ProductSortName, ProductSortNameDesc, ProductSortPrice, ProductSortPriceDesc:
+		return nil
+	default:
+		return ErrInvalidProductSort
+	}
+}
+
+// ProductCursor is the position of the last product of a page in its sort order.
+type ProductCursor struct {
+	Sort  string `json:"s"`
+	ID    int    `json:"id"`
+	Name  string `json:"n,omitempty"`
+	Price Money  `json:"p,omitempty"` // in the currency of the page
+	// Currency prices were sorted in, so a cursor is not reused with another currency
+	Currency string `json:"c,omitempty"`
+}
+
+// ProductPage is a page of products along with the total number of matches.
+type ProductPage struct {
+	Items      []Product `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Total      int       `json:"total"`
 }
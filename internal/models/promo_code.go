@@ -1,6 +1,219 @@
 package models
 
+import (
+	"time"
+
+	"github.com/guregu/null"
+)
+
+type DiscountType string
+
+const (
+	DiscountPercentage DiscountType = "percentage"
+	DiscountFixed      DiscountType = "fixed"
+	DiscountFreeItem   DiscountType = "free_item"
+)
+
 type PromoCode struct {
-	Code    string
-	IsValid bool
+	Code          string       `json:"code"`
+	IsValid       bool         `json:"is_valid"`
+	DiscountType  DiscountType `json:"discount_type,omitempty"`
+	DiscountValue Money        `json:"discount_value,omitempty"` // a percentage for percentage codes, an amount for fixed ones
+	FreeProductID int          `json:"free_product_id,omitempty"`
+	MaxDiscount   Money        `json:"max_discount,omitempty"`
+
+	// Redemption limits, zero meaning unlimited
+	MaxRedemptions            int  `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerCustomer int  `json:"max_redemptions_per_customer,omitempty"`
+	SingleUse                 bool `json:"single_use,omitempty"`
+
+	// Restrictions, empty meaning unrestricted
+	StartsAt          null.Time `json:"starts_at"`
+	EndsAt            null.Time `json:"ends_at"`
+	MinOrderValue     Money     `json:"min_order_value,omitempty"`
+	AllowedCategories []string  `json:"allowed_categories,omitempty"`
+	AllowedProductIDs []int     `json:"allowed_product_ids,omitempty"`
+}
+
+// RedemptionLimit returns the total number of orders the code may be used on, zero meaning unlimited.
+func (p *PromoCode) RedemptionLimit() int {
+	if p.SingleUse {
+		return 1
+	}
+	return p.MaxRedemptions
+}
+
+// Reasons a coupon is rejected
+const (
+	CouponReasonInvalidFormat   = "invalid_format"
+	CouponReasonUnknownCode     = "unknown_code"
+	CouponReasonNotStarted      = "not_started"
+	CouponReasonExpired         = "expired"
+	CouponReasonBelowMinimum    = "basket_below_minimum"
+	CouponReasonNoEligibleItems = "no_eligible_items"
+	CouponReasonEmptyOrder      = "empty_order"
+)
+
+// couponReasonMessages describes each rejection reason to customers
+var couponReasonMessages = map[string]string{
+	CouponReasonInvalidFormat:   "Coupon code must be 8 to 10 characters long",
+	CouponReasonUnknownCode:     "Coupon code does not exist",
+	CouponReasonNotStarted:      "Coupon is not active yet",
+	CouponReasonExpired:         "Coupon has expired",
+	CouponReasonBelowMinimum:    "Order total is below the coupon minimum",
+	CouponReasonNoEligibleItems: "Coupon does not apply to any item in the order",
+	CouponReasonEmptyOrder:      "Order has no items to apply the coupon to",
+}
+
+// CouponReasonMessage returns a human readable description of a rejection reason.
+func CouponReasonMessage(reason string) string {
+	if message, ok := couponReasonMessages[reason]; ok {
+		return message
+	}
+	return "Invalid coupon"
+}
+
+// CouponValidationRequest asks whether a coupon applies to a cart.
+type CouponValidationRequest struct {
+	Code     string      `json:"code"`
+	Items    []OrderItem `json:"items"`
+	Currency string      `json:"currency"`
+}
+
+// Validate checks the items and currency as those of an order, so a quote is only given for a
+// cart that could be ordered.
+func (r *CouponValidationRequest) Validate() error {
+	orderReq := OrderRequest{Items: r.Items, Currency: NormalizeCurrency(r.Currency)}
+	return orderReq.Validate()
+}
+
+// CouponQuote is the outcome of checking a coupon against a cart.
+type CouponQuote struct {
+	Code       string `json:"code"`
+	Valid      bool   `json:"valid"`
+	Reason     string `json:"reason,omitempty"`
+	Subtotal   Money  `json:"subtotal"`
+	Discount   Money  `json:"discount"`
+	FinalPrice Money  `json:"final_price"`
+	Currency   string `json:"currency"`
+}
+
+// Check returns the reason the code cannot be applied to the given priced items at time now,
+// or an empty string when it applies. categories maps product IDs to their category.
+func (p *PromoCode) Check(items []OrderItem, categories map[int]string, now time.Time) string {
+	if p.StartsAt.Valid && now.Before(p.StartsAt.Time) {
+		return CouponReasonNotStarted
+	}
+	if p.EndsAt.Valid && !now.Before(p.EndsAt.Time) {
+		return CouponReasonExpired
+	}
+	if len(items) == 0 {
+		return CouponReasonEmptyOrder
+	}
+	if p.MinOrderValue > 0 && Subtotal(items) < p.MinOrderValue {
+		return CouponReasonBelowMinimum
+	}
+	if len(p.eligibleItems(items, categories)) == 0 {
+		return CouponReasonNoEligibleItems
+	}
+	return ""
+}
+
+// IsEligible reports whether the code's discount applies to a product.
+func (p *PromoCode) IsEligible(productID int, category string) bool {
+	if len(p.AllowedCategories) == 0 && len(p.AllowedProductIDs) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedCategories {
+		if allowed == category {
+			return true
+		}
+	}
+	for _, allowed := range p.AllowedProductIDs {
+		if allowed == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// Discount returns the amount taken off an order made of the given priced items.
+// Only eligible items are discounted, and the result never exceeds MaxDiscount (when set)
+// nor their subtotal. categories maps product IDs to their category.
+func (p *PromoCode) Discount(items []OrderItem, categories map[int]string) Money {
+	eligible := p.eligibleItems(items, categories)
+	subtotal := Subtotal(eligible)
+
+	var discount Money
+	switch p.DiscountType {
+	case DiscountPercentage:
+		discount = subtotal.Percent(p.DiscountValue)
+	case DiscountFixed:
+		discount = p.DiscountValue
+	case DiscountFreeItem:
+		// One unit of the free product is on the house, if it is in the cart
+		for _, item := range eligible {
+			if item.ProductID == p.FreeProductID && item.Quantity > 0 {
+				discount = item.Price
+				break
+			}
+		}
+	}
+
+	if p.MaxDiscount > 0 && discount > p.MaxDiscount {
+		discount = p.MaxDiscount
+	}
+	if discount > subtotal {
+		discount = subtotal
+	}
+	if discount < 0 {
+		discount = 0
+	}
+	return discount
+}
+
+// AllocateDiscount spreads an order discount over the lines it applies to, in proportion to
+// their amount, so that each line is taxed on what the customer actually pays for it.
+func (p *PromoCode) AllocateDiscount(items []OrderItem, categories map[int]string, discount Money) {
+	weights := make([]Money, len(items))
+	for i, item := range items {
+		eligible := p.IsEligible(item.ProductID, categories[item.ProductID])
+		if p.DiscountType == DiscountFreeItem {
+			eligible = eligible && item.ProductID == p.FreeProductID
+		}
+		if eligible {
+			weights[i] = item.Price.Mul(item.Quantity)
+		}
+	}
+	for i, part := range allocate(discount, weights) {
+		items[i].Discount = part
+	}
+}
+
+// eligibleItems returns the items the code's discount applies to.
+func (p *PromoCode) eligibleItems(items []OrderItem, categories map[int]string) []OrderItem {
+	eligible := make([]OrderItem, 0, len(items))
+	for _, item := range items {
+		if p.IsEligible(item.ProductID, categories[item.ProductID]) {
+			eligible = append(eligible, item)
+		}
+	}
+	return eligible
+}
+
+// CouponBaseFile describes the version of a coupon base file that was loaded.
+type CouponBaseFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Checksum   string    `json:"sha256"`
+	Codes      int       `json:"codes"`
+}
+
+// CouponStatus reports what the coupon index currently holds. It is public, so it names the
+// base files but not where the server keeps them.
+type CouponStatus struct {
+	Files    []CouponBaseFile `json:"files"`
+	Codes    int              `json:"valid_codes"`
+	LoadedAt time.Time        `json:"loaded_at"`
 }
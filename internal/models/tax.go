@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// DefaultTaxCategory is the rule applied to categories without a rule of their own
+const DefaultTaxCategory = "*"
+
+// maxTaxRate is 100.00%
+const maxTaxRate Money = 10000
+
+var (
+	ErrInvalidTaxRate     = errors.New("tax rate must be a percentage between 0 and 100 with at most 2 decimals")
+	ErrInvalidTaxCategory = errors.New("tax category must be a product category or *")
+)
+
+// TaxRule is the tax charged on the products of a category. Inclusive rules mean catalog
+// prices already contain the tax; exclusive ones add it on top.
+type TaxRule struct {
+	Category  string `json:"category"`
+	Rate      Money  `json:"rate"` // a percentage, e.g. 20.00
+	Inclusive bool   `json:"inclusive"`
+}
+
+// NormalizeTaxCategory lowercases and trims a category, the same way product categories are.
+func NormalizeTaxCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// Validate checks the rule fits the tax_rules table.
+func (r *TaxRule) Validate() error {
+	if r.Category == "" || len(r.Category) > 50 {
+		return ErrInvalidTaxCategory
+	}
+	if r.Rate < 0 || r.Rate > maxTaxRate {
+		return ErrInvalidTaxRate
+	}
+	return nil
+}
+
+// TaxRules maps categories to their tax rule.
+type TaxRules map[string]TaxRule
+
+// NewTaxRules indexes rules by category.
+func NewTaxRules(rules []TaxRule) TaxRules {
+	byCategory := make(TaxRules, len(rules))
+	for _, rule := range rules {
+		byCategory[rule.Category] = rule
+	}
+	return byCategory
+}
+
+// For returns the rule of a category, falling back to the default rule, then to no tax.
+func (r TaxRules) For(category string) TaxRule {
+	if rule, ok := r[category]; ok {
+		return rule
+	}
+	if rule, ok := r[DefaultTaxCategory]; ok {
+		return rule
+	}
+	return TaxRule{Category: category}
+}
+
+// TaxSummary totals the lines of an order taxed at the same rate, as printed on receipts.
+type TaxSummary struct {
+	Rate  Money `json:"rate"`
+	Net   Money `json:"net"`
+	Tax   Money `json:"tax"`
+	Gross Money `json:"gross"`
+}
+
+// ApplyTaxes computes the net, tax and gross amounts of every line from its price, quantity
+// and discount, using the rule of the product's category. categories maps product IDs to
+// their category.
+func ApplyTaxes(items []OrderItem, categories map[int]string, rules TaxRules) {
+	for i := range items {
+		item := &items[i]
+		rule := rules.For(categories[item.ProductID])
+		amount := item.Price.Mul(item.Quantity) - item.Discount
+
+		item.TaxRate = rule.Rate
+		item.TaxInclusive = rule.Inclusive
+		if rule.Inclusive {
+			item.Gross = amount
+			item.Net = Money(mulDiv(int64(amount), int64(maxTaxRate), int64(maxTaxRate+rule.Rate)))
+			item.Tax = item.Gross - item.Net
+		} else {
+			item.Net = amount
+			item.Tax = amount.Percent(rule.Rate)
+			item.Gross = item.Net + item.Tax
+		}
+	}
+}
+
+// SummarizeTaxes groups order lines by tax rate, lowest rate first.
+func SummarizeTaxes(items []OrderItem) []TaxSummary {
+	byRate := map[Money]int{}
+	summaries := []TaxSummary{}
+	for _, item := range items {
+		i, ok := byRate[item.TaxRate]
+		if !ok {
+			i = len(summaries)
+			summaries = append(summaries, TaxSummary{Rate: item.TaxRate})
+			byRate[item.TaxRate] = i
+		}
+		summary := &summaries[i]
+		summary.Net += item.Net
+		summary.Tax += item.Tax
+		summary.Gross += item.Gross
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Rate < summaries[j].Rate })
+	return summaries
+}
+
+// SetTotals fills the order's net, tax and final prices and its tax summary from its lines.
+func (o *Order) SetTotals() {
+	o.Net, o.Tax, o.FinalPrice = 0, 0, 0
+	for _, item := range o.Items {
+		o.Net += item.Net
+		o.Tax += item.Tax
+		o.FinalPrice += item.Gross
+	}
+	o.Taxes = SummarizeTaxes(o.Items)
+}
+
+// allocate splits amount across weights in proportion, rounding down, then gives
+// the remaining cents to the heaviest weight so the parts add up exactly.
+func allocate(amount Money, weights []Money) []Money {
+	parts := make([]Money, len(weights))
+	var total Money
+	heaviest := -1
+	for i, weight := range weights {
+		total += weight
+		if heaviest < 0 || weight > weights[heaviest] {
+			heaviest = i
+		}
+	}
+	if total <= 0 {
+		return parts
+	}
+
+	remaining := amount
+	for i, weight := range weights {
+		share := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(int64(weight)))
+		parts[i] = Money(share.Quo(share, big.NewInt(int64(total))).Int64())
+		remaining -= parts[i]
+	}
+	parts[heaviest] += remaining
+	return parts
+}
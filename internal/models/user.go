@@ -0,0 +1,94 @@
+package models
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Bounds on passwords. bcrypt ignores everything past 72 bytes, so longer ones are rejected
+// rather than silently truncated.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// User is a customer account.
+type User struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NormalizeEmail trims and lowercases an email address, so it is stored and looked up one way.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// RegisterRequest creates a customer account.
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+// Normalize lowercases the email and trims the name.
+func (r *RegisterRequest) Normalize() {
+	r.Email = NormalizeEmail(r.Email)
+	r.Name = strings.TrimSpace(r.Name)
+}
+
+// Validate checks the account fits the users table and reports all the rejected fields at once.
+func (r *RegisterRequest) Validate() error {
+	var errs ValidationErrors
+	if address, err := mail.ParseAddress(r.Email); err != nil || address.Address != r.Email || len(r.Email) > 255 {
+		errs.Add("email", "must be a valid email address")
+	}
+	if len(r.Password) < MinPasswordLength || len(r.Password) > MaxPasswordLength {
+		errs.Add("password", "must be between 8 and 72 bytes long")
+	}
+	if len(r.Name) > 255 {
+		errs.Add("name", "must be at most 255 characters long")
+	}
+	return errs.Err()
+}
+
+// RoleRequest assigns a role to an account.
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// LoginRequest exchanges a customer's credentials for tokens.
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest exchanges a refresh token for new tokens, or revokes it on logout.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenPair is returned when a customer logs in or refreshes their tokens.
+// The refresh token can be used once: refreshing returns a new one.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // seconds
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token is kept.
+// Tokens rotated from the same login share a family, which is revoked as a whole when
+// a rotated token is presented again.
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrValidation matches every ValidationErrors, whatever fields they name.
+var ErrValidation = errors.New("validation failed")
+
+// FieldError tells why a field of a request was rejected. Fields are named as in the
+// JSON body, with indexes for list elements, e.g. items[2].quantity.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every rejected field of a request, so clients can fix them all at once.
+type ValidationErrors []FieldError
+
+// Add records a rejected field.
+func (e *ValidationErrors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Err returns nil when no field was rejected.
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is makes errors.Is(err, ErrValidation) hold for any ValidationErrors.
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrValidation
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"order_food_online/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(key models.APIKey) (*models.APIKey, error)
+	ListAPIKeys() ([]models.APIKey, error)
+	GetAPIKeyByHash(keyHash string) (*models.APIKey, error)
+	RevokeAPIKey(id int) error
+	TouchAPIKey(id int, usedAt time.Time) error
+}
+
+type APIKeyRepo struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &APIKeyRepo{db: db}
+}
+
+// lastUsedPrecision bounds how often the last use of a key is written,
+// so busy keys do not cause a write per request
+const lastUsedPrecision = time.Minute
+
+const selectAPIKey = `SELECT id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at, revoked_at, key_hash FROM api_keys`
+
+// CreateAPIKey inserts an API key.
+func (r *APIKeyRepo) CreateAPIKey(key models.APIKey) (*models.APIKey, error) {
+	err := r.db.QueryRow(
+		`INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, expires_at) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.CreatedBy, key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert API key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListAPIKeys retrieves every API key, revoked and expired ones included, most recent first.
+func (r *APIKeyRepo) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := r.db.Query(selectAPIKey + ` ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash retrieves the API key with the given SHA-256 hash.
+func (r *APIKeyRepo) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(selectAPIKey+` WHERE key_hash = $1`, keyHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API key: %w", err)
+	}
+	return key, nil
+}
+
+// RevokeAPIKey revokes an API key. Revoking a key twice fails with sql.ErrNoRows.
+func (r *APIKeyRepo) RevokeAPIKey(id int) error {
+	result, err := r.db.Exec(`UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key ID %d: %w", id, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return fmt.Errorf("failed to revoke API key ID %d: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// TouchAPIKey records the key was used, unless that was already recorded less than a minute earlier.
+func (r *APIKeyRepo) TouchAPIKey(id int, usedAt time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE api_keys SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)`,
+		id, usedAt, usedAt.Add(-lastUsedPrecision),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record use of API key ID %d: %w", id, err)
+	}
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(
+		&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedBy, &key.CreatedAt,
+		&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.KeyHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"order_food_online/internal/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// couponBases lists the coupon files a valid code has to appear in at least twice.
+var couponBases = []string{"couponbase1", "couponbase2", "couponbase3"}
+
+const (
+	minCouponLength  = 8
+	maxCouponLength  = 10
+	minCouponMatches = 2
+)
+
+type CouponRepository interface {
+	IsValid(code string) bool
+	Len() int
+	Dir() string
+	Reload() ([]string, error)
+	Status() models.CouponStatus
+}
+
+// couponKey is a fixed-size code representation, much lighter in a map than a string.
+type couponKey [maxCouponLength]byte
+
+// couponIndex is an immutable snapshot of the coupon bases.
+type couponIndex struct {
+	codes    map[couponKey]struct{}
+	files    []models.CouponBaseFile
+	loadedAt time.Time
+}
+
+type CouponRepo struct {
+	dir    string
+	index  atomic.Pointer[couponIndex]
+	reload sync.Mutex
+}
+
+// NewCouponRepository loads the coupon bases found in dir into an in-memory index.
+// Each base is read from its .gz file, or from a plain .txt copy when there is no archive.
+func NewCouponRepository(dir string) (CouponRepository, error) {
+	index, err := loadCouponBases(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &CouponRepo{dir: dir}
+	r.index.Store(index)
+	return r, nil
+}
+
+// IsValid reports whether code appears in at least two of the coupon bases.
+func (r *CouponRepo) IsValid(code string) bool {
+	key, ok := toCouponKey(code)
+	if !ok {
+		return false
+	}
+	_, found := r.index.Load().codes[key]
+	return found
+}
+
+// Len returns the number of valid codes in the index.
+func (r *CouponRepo) Len() int {
+	return len(r.index.Load().codes)
+}
+
+// Dir returns the directory the coupon bases are loaded from.
+func (r *CouponRepo) Dir() string {
+	return r.dir
+}
+
+// Reload rebuilds the index from disk and swaps it in atomically.
+// It returns the codes whose validity changed; on error the current index is kept.
+func (r *CouponRepo) Reload() ([]string, error) {
+	r.reload.Lock()
+	defer r.reload.Unlock()
+
+	index, err := loadCouponBases(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	previous := r.index.Swap(index)
+
+	var changed []string
+	for key := range previous.codes {
+		if _, found := index.codes[key]; !found {
+			changed = append(changed, key.String())
+		}
+	}
+	for key := range index.codes {
+		if _, found := previous.codes[key]; !found {
+			changed = append(changed, key.String())
+		}
+	}
+	return changed, nil
+}
+
+// Status describes the currently loaded coupon bases.
+func (r *CouponRepo) Status() models.CouponStatus {
+	index := r.index.Load()
+	return models.CouponStatus{
+		Files:    index.files,
+		Codes:    len(index.codes),
+		LoadedAt: index.loadedAt,
+	}
+}
+
+// IsCouponBaseFile reports whether path names one of the coupon base files.
+func IsCouponBaseFile(path string) bool {
+	name := filepath.Base(path)
+	for _, base := range couponBases {
+		if name == base+".txt" || name == base+".gz" {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCouponBases builds the set of codes present in at least minCouponMatches bases.
+func loadCouponBases(dir string) (*couponIndex, error) {
+	files := make([]models.CouponBaseFile, 0, len(couponBases))
+	// Bit i of a code's mask is set when the code appears in base i
+	masks := make(map[couponKey]uint8)
+	for i, base := range couponBases {
+		bit := uint8(1) << i
+		// A code first seen in a late base can no longer reach the required
+		// number of matches, so there is no point in keeping track of it.
+		canAdd := len(couponBases)-i >= minCouponMatches
+
+		file, err := scanCouponBase(dir, base, func(key couponKey) {
+			if mask, seen := masks[key]; seen {
+				masks[key] = mask | bit
+			} else if canAdd {
+				masks[key] = bit
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *file)
+	}
+
+	codes := make(map[couponKey]struct{})
+	for key, mask := range masks {
+		if bits.OnesCount8(mask) >= minCouponMatches {
+			codes[key] = struct{}{}
+		}
+	}
+	return &couponIndex{codes: codes, files: files, loadedAt: time.Now()}, nil
+}
+
+// scanCouponBase calls fn for every well-formed code of the given base
+// and returns the version of the file it was read from.
+func scanCouponBase(dir, base string, fn func(couponKey)) (*models.CouponBaseFile, error) {
+	file, err := openCouponBase(dir, base)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Checksum the raw file while it is being read
+	hash := sha256.New()
+	reader, err := decompressCouponBase(io.TeeReader(file, hash), file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress coupon base %s: %w", base, err)
+	}
+
+	codes := 0
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if key, ok := toCouponKey(strings.TrimSpace(scanner.Text())); ok {
+			fn(key)
+			codes++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read coupon base %s: %w", base, err)
+	}
+
+	return &models.CouponBaseFile{
+		Name:       info.Name(),
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime(),
+		Checksum:   hex.EncodeToString(hash.Sum(nil)),
+		Codes:      codes,
+	}, nil
+}
+
+// openCouponBase opens the gzip archive of a base, falling back to a plain text copy. The archive
+// is the reference: a .txt file next to it is ignored.
+func openCouponBase(dir, base string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(dir, base+".gz"))
+	if err == nil {
+		return file, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err = os.Open(filepath.Join(dir, base+".txt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open coupon base %s: %w", base, err)
+	}
+	return file, nil
+}
+
+// decompressCouponBase wraps reader in a gzip decompressor for .gz files.
+func decompressCouponBase(reader io.Reader, name string) (io.Reader, error) {
+	if filepath.Ext(name) != ".gz" {
+		return reader, nil
+	}
+	return gzip.NewReader(reader)
+}
+
+// toCouponKey converts a code to its index key, rejecting codes of invalid length.
+func toCouponKey(code string) (couponKey, bool) {
+	var key couponKey
+	if len(code) < minCouponLength || len(code) > maxCouponLength {
+		return key, false
+	}
+	copy(key[:], code)
+	return key, true
+}
+
+// String returns the code a key was built from.
+func (k couponKey) String() string {
+	return strings.TrimRight(string(k[:]), "\x00")
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"order_food_online/internal/models"
+	"sort"
+)
+
+type ExchangeRateRepository interface {
+	ListRates() ([]models.ExchangeRate, error)
+	GetRate(currency string) (*models.ExchangeRate, error)
+	SetRates(rates map[string]models.Rate) error
+	DeleteRate(currency string) error
+}
+
+type ExchangeRateRepo struct {
+	db *sql.DB
+}
+
+func NewExchangeRateRepository(db *sql.DB) ExchangeRateRepository {
+	return &ExchangeRateRepo{db: db}
+}
+
+// ListRates retrieves every exchange rate, ordered by currency.
+func (r *ExchangeRateRepo) ListRates() ([]models.ExchangeRate, error) {
+	rows, err := r.db.Query(`SELECT currency, rate, updated_at FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// GetRate retrieves the exchange rate of a currency, or nil when it has none.
+func (r *ExchangeRateRepo) GetRate(currency string) (*models.ExchangeRate, error) {
+	rate := models.ExchangeRate{Currency: currency}
+	err := r.db.QueryRow(`SELECT rate, updated_at FROM exchange_rates WHERE currency = $1`, currency).
+		Scan(&rate.Rate, &rate.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", currency, err)
+	}
+	return &rate, nil
+}
+
+// SetRates inserts or updates the given rates in a single transaction.
+func (r *ExchangeRateRepo) SetRates(rates map[string]models.Rate) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Upsert in a stable order so concurrent updates lock rows consistently
+	currencies := make([]string, 0, len(rates))
+	for currency := range rates {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		_, err = tx.Exec(
+			`INSERT INTO exchange_rates (currency, rate) VALUES ($1, $2)
+			ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = CURRENT_TIMESTAMP`,
+			currency, rates[currency],
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save exchange rate for %s: %w", currency, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit exchange rates: %w", err)
+	}
+	return nil
+}
+
+// DeleteRate removes the exchange rate of a currency.
+func (r *ExchangeRateRepo) DeleteRate(currency string) error {
+	result, err := r.db.Exec(`DELETE FROM exchange_rates WHERE currency = $1`, currency)
+	if err != nil {
+		return fmt.Errorf("failed to delete exchange rate for %s: %w", currency, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return fmt.Errorf("failed to delete exchange rate for %s: %w", currency, sql.ErrNoRows)
+	}
+	return nil
+}
@@ -2,46 +2,206 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"order_food_online/internal/cache"
 	"order_food_online/internal/models"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/guregu/null/zero"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrCouponRedemptionLimit is returned when a coupon has been used as many times as it allows
+	ErrCouponRedemptionLimit = errors.New("coupon redemption limit reached")
+	// ErrInvalidStatusTransition is returned when an order cannot move to the requested status
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	// ErrCancellationClosed is returned when an order can no longer be cancelled by its customer
+	ErrCancellationClosed = errors.New("order can no longer be cancelled")
+	// ErrDuplicateIdempotencyKey is returned when another order was already placed with the same idempotency key
+	ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+	// ErrOutOfStock is returned, wrapped in an OutOfStockError, when an ordered product has run out
+	ErrOutOfStock = errors.New("out of stock")
 )
 
+// OutOfStockError names the product an order could not be fulfilled for.
+type OutOfStockError struct {
+	ProductID   int
+	ProductName string
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("%s is out of stock", e.ProductName)
+}
+
+// Is makes errors.Is(err, ErrOutOfStock) hold for every OutOfStockError.
+func (e *OutOfStockError) Is(target error) bool {
+	return target == ErrOutOfStock
+}
+
+// ErrCouponNotApplicable is returned, wrapped in a CouponNotApplicableError, when the coupon of
+// an order does not apply to it once its products are locked
+var ErrCouponNotApplicable = errors.New("coupon does not apply to the order")
+
+// CouponNotApplicableError gives the reason the coupon of an order does not apply to it.
+type CouponNotApplicableError struct {
+	Reason string
+}
+
+func (e *CouponNotApplicableError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCouponNotApplicable, e.Reason)
+}
+
+// Is makes errors.Is(err, ErrCouponNotApplicable) hold for every CouponNotApplicableError.
+func (e *CouponNotApplicableError) Is(target error) bool {
+	return target == ErrCouponNotApplicable
+}
+
+// ErrUnknownProduct is returned, wrapped in an UnknownProductsError, when an order names products that do not exist
+var ErrUnknownProduct = errors.New("unknown product")
+
+// UnknownProductsError lists the products of an order that do not exist or were deleted.
+type UnknownProductsError struct {
+	ProductIDs []int
+}
+
+func (e *UnknownProductsError) Error() string {
+	ids := make([]string, len(e.ProductIDs))
+	for i, id := range e.ProductIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("%s: %s", ErrUnknownProduct, strings.Join(ids, ", "))
+}
+
+// Is makes errors.Is(err, ErrUnknownProduct) hold for every UnknownProductsError.
+func (e *UnknownProductsError) Is(target error) bool {
+	return target == ErrUnknownProduct
+}
+
+// idempotencyKeyTTL is how long idempotency keys are remembered in Redis; the database keeps them for good
+const idempotencyKeyTTL = 24 * time.Hour
+
 type OrderRepository interface {
-	GetAllOrders() ([]models.Order, error)
+	ListOrders(query models.OrderQuery) (*models.OrderPage, error)
 	GetOrderByID(id int) (*models.Order, error)
-	PlaceOrder(orderReq models.OrderRequest) (*models.Order, error)
-	CheckProductExists(id int) (bool, error)
+	PlaceOrder(orderReq models.OrderRequest, currency models.CurrencyConverter) (*models.Order, error)
+	UpdateOrderStatus(id int, statusReq models.OrderStatusRequest, changedBy string) (*models.Order, error)
+	GetOrderStatusHistory(id int) ([]models.OrderStatusChange, error)
+	CancelOrder(id int, cancelReq models.CancelOrderRequest, changedBy string, window time.Duration) (*models.Order, error)
+	FindIdempotencyRecord(key string) (*models.IdempotencyRecord, error)
 }
 
 type OrderRepo struct {
-	db    *sql.DB
-	cache cache.OrderCache
+	db           *sql.DB
+	cache        cache.OrderCache
+	productCache cache.ProductCache
 }
 
-func NewOrderRepository(db *sql.DB, cache cache.OrderCache) OrderRepository {
-	return &OrderRepo{db: db, cache: cache}
+func NewOrderRepository(db *sql.DB, cache cache.OrderCache, productCache cache.ProductCache) OrderRepository {
+	return &OrderRepo{db: db, cache: cache, productCache: productCache}
 }
 
-// GetAllOrders retrieves all orders, attempting to use cache first.
-func (r *OrderRepo) GetAllOrders() ([]models.Order, error) {
-	// Try Redis cache first
-	cachedOrders, err := r.cache.GetAllOrders()
+// ListOrders retrieves a page of orders matching the query, most recent first.
+// Pages of a customer's orders are cached until the customer's orders change; other pages
+// are read from the database directly, as they change with every new order.
+func (r *OrderRepo) ListOrders(query models.OrderQuery) (*models.OrderPage, error) {
+	if query.CustomerID == 0 {
+		return r.fetchOrderPageFromDB(query)
+	}
+
+	// Try Redis cache
+	cachedPage, err := r.cache.GetCustomerOrderPage(query)
 	if err == nil {
-		return cachedOrders, nil
+		return cachedPage, nil
 	}
 
 	// Fallback to DB
-	orders, err := r.fetchAllOrdersFromDB()
+	page, err := r.fetchOrderPageFromDB(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch all orders from database: %w", err)
+		return nil, err
 	}
 
-	// Update Redis cache (non-blocking)
-	_ = r.cache.SetAllOrders(orders, 10*time.Minute)
+	// Cache result (non-blocking)
+	_ = r.cache.SetCustomerOrderPage(query, page, 10*time.Minute)
 
-	return orders, nil
+	return page, nil
+}
+
+// fetchOrderPageFromDB retrieves a page of orders using keyset pagination.
+func (r *OrderRepo) fetchOrderPageFromDB(query models.OrderQuery) (*models.OrderPage, error) {
+	conditions := []string{"TRUE"}
+	var args []any
+	where := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if query.From.Valid {
+		where("created_at >= $%d", query.From.Time)
+	}
+	if query.To.Valid {
+		where("created_at < $%d", query.To.Time)
+	}
+	if query.CouponCode != "" {
+		where("coupon_code = $%d", query.CouponCode)
+	}
+	if query.Status != "" {
+		where("status = $%d", query.Status)
+	}
+	if query.Currency != "" {
+		where("currency = $%d", query.Currency)
+	}
+	if query.CustomerID != 0 {
+		where("customer_id = $%d", query.CustomerID)
+	}
+	if query.APIKeyID != 0 {
+		where("api_key_id = $%d", query.APIKeyID)
+	}
+
+	// Resume after the last order of the previous page
+	if query.Cursor != "" {
+		var cursor models.OrderCursor
+		if err := models.DecodeCursor(query.Cursor, &cursor); err != nil {
+			return nil, err
+		}
+		where("id < $%d", cursor.ID)
+	}
+
+	// Fetch one extra order to know whether there is a next page,
+	// along with the items of every order in the same query
+	rows, err := r.db.Query(
+		fmt.Sprintf(
+			`WITH page AS (
+				SELECT id, customer_id, api_key_id, coupon_code, subtotal, discount, net_total, tax_total, final_price, currency, status, created_at, cancellation_reason
+				FROM orders
+				WHERE %s ORDER BY id DESC LIMIT %d
+			)
+			%s FROM page o %s ORDER BY o.id DESC, i.id`,
+			strings.Join(conditions, " AND "), query.Limit+1, selectOrderWithItems, joinOrderItems,
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch orders from database: %w", err)
+	}
+
+	page := models.OrderPage{}
+	page.Items, err = scanOrdersWithItems(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) > query.Limit {
+		page.Items = page.Items[:query.Limit]
+		page.NextCursor, err = models.EncodeCursor(models.OrderCursor{ID: page.Items[len(page.Items)-1].ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &page, nil
 }
 
 // GetOrderByID retrieves a specific order by ID, attempting to use cache first.
@@ -65,7 +225,9 @@ func (r *OrderRepo) GetOrderByID(id int) (*models.Order, error) {
 }
 
 // PlaceOrder inserts a new order into the database and updates the cache.
-func (r *OrderRepo) PlaceOrder(orderReq models.OrderRequest) (*models.Order, error) {
+// Items are priced in the converter's currency, at their native price when the product has one,
+// and taken from the stock of stock-tracked products.
+func (r *OrderRepo) PlaceOrder(orderReq models.OrderRequest, currency models.CurrencyConverter) (*models.Order, error) {
 	// Begin a transaction
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -77,114 +239,594 @@ func (r *OrderRepo) PlaceOrder(orderReq models.OrderRequest) (*models.Order, err
 			panic(p)
 		} else if err != nil {
 			tx.Rollback()
-		} else {
-			tx.Commit()
 		}
 	}()
 
 	// Insert the order
 	var order models.Order
+	idempotencyKey := zero.StringFrom(orderReq.IdempotencyKey)
+	requestHash := orderReq.Fingerprint()
 	err = tx.QueryRow(
-		`INSERT INTO orders (coupon_code, final_price) VALUES ($1, 0) RETURNING id, coupon_code`,
-		orderReq.CouponCode,
-	).Scan(&order.ID, &order.CouponCode)
+		`INSERT INTO orders (coupon_code, final_price, currency, idempotency_key, request_hash, customer_id, api_key_id)
+		VALUES ($1, 0, $2, $3, $4, $5, $6)
+		RETURNING id, customer_id, api_key_id, COALESCE(coupon_code, ''), currency, status, created_at`,
+		orderReq.CouponCode, currency.Currency, idempotencyKey, requestHash, orderReq.CustomerID, orderReq.APIKeyID,
+	).Scan(&order.ID, &order.CustomerID, &order.APIKeyID, &order.CouponCode, &order.Currency, &order.Status, &order.CreatedAt)
+	if isUniqueViolation(err, "orders_idempotency_key_idx") {
+		return nil, ErrDuplicateIdempotencyKey
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert order: %w", err)
 	}
 
-	// Insert the order items and calculate the final price
-	var finalPrice float64
+	// Fetch and lock the ordered products in a single query
+	var products map[int]orderedProduct
+	products, err = fetchOrderedProductsTx(tx, orderReq.Items, currency.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ordered products: %w", err)
+	}
+	var missing []int
+	for _, item := range orderReq.Items {
+		if _, ok := products[item.ProductID]; !ok {
+			missing = append(missing, item.ProductID)
+		}
+	}
+	if len(missing) > 0 {
+		err = &UnknownProductsError{ProductIDs: missing}
+		return nil, err
+	}
+
+	// Price the order items at their current product prices and check their stock
+	items := make([]models.OrderItem, 0, len(orderReq.Items))
+	categories := make(map[int]string, len(orderReq.Items))
+	var reserved []int
 	for _, item := range orderReq.Items {
-		// Retrieve product price
-		var price float64
-		err := tx.QueryRow(
-			`SELECT price FROM products WHERE id = $1`, item.ProductID,
-		).Scan(&price)
+		product := products[item.ProductID]
+		if !product.available || product.stock.Valid && product.stock.Int64 < int64(item.Quantity) {
+			err = &OutOfStockError{ProductID: item.ProductID, ProductName: product.name}
+			return nil, err
+		}
+		if product.stock.Valid {
+			item.StockReserved = true
+			reserved = append(reserved, item.ProductID)
+		}
+
+		item.OrderID = order.ID
+		item.ProductName = product.name
+		item.Price, err = currency.Price(product.basePrice, product.nativePrice)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch product price for product ID %d: %w", item.ProductID, err)
+			return nil, err
 		}
+		items = append(items, item)
+		categories[item.ProductID] = product.category
+	}
+	if err = reserveStockTx(tx, items); err != nil {
+		return nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
 
-		// Insert the item
-		_, err = tx.Exec(
-			`INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4)`,
-			order.ID, item.ProductID, item.Quantity, price,
-		)
+	// Redeem the coupon and apply its discount, if the code carries one
+	subtotal := models.Subtotal(items)
+	var discount models.Money
+	if order.CouponCode != "" {
+		var promo *models.PromoCode
+		promo, err = r.fetchPromoCodeTx(tx, order.CouponCode)
 		if err != nil {
-			return nil, fmt.Errorf("failed to insert order item for product ID %d: %w", item.ProductID, err)
+			return nil, fmt.Errorf("failed to fetch discount for coupon %s: %w", order.CouponCode, err)
+		}
+		// The coupon was checked before the transaction: check it again against the locked
+		// products, whose category or price may have changed meanwhile, before redeeming it
+		var localPromo models.PromoCode
+		if promo != nil {
+			localPromo, err = currency.PromoCode(*promo)
+			if err != nil {
+				return nil, err
+			}
+			if reason := localPromo.Check(items, categories, time.Now()); reason != "" {
+				err = &CouponNotApplicableError{Reason: reason}
+				return nil, err
+			}
+		}
+		if err = r.redeemCouponTx(tx, order.CouponCode, promo, order.ID, orderReq.CustomerID); err != nil {
+			return nil, fmt.Errorf("failed to redeem coupon %s: %w", order.CouponCode, err)
 		}
+		if promo != nil {
+			discount = localPromo.Discount(items, categories)
+			localPromo.AllocateDiscount(items, categories, discount)
+		}
+	}
+
+	// Tax each line on its discounted amount
+	var rules []models.TaxRule
+	rules, err = fetchTaxRules(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tax rules: %w", err)
+	}
+	models.ApplyTaxes(items, categories, models.NewTaxRules(rules))
 
-		// Accumulate final price
-		finalPrice += price * float64(item.Quantity)
+	// Insert the items, keeping a snapshot of the product name, price and taxes
+	if err = insertOrderItemsTx(tx, items); err != nil {
+		return nil, fmt.Errorf("failed to insert items of order ID %d: %w", order.ID, err)
 	}
 
-	// Update the order's final price
+	// Set order details
+	order.Items = items
+	order.Subtotal = subtotal
+	order.Discount = discount
+	order.SetTotals()
+
+	// Update the order's totals
 	_, err = tx.Exec(
-		`UPDATE orders SET final_price = $1 WHERE id = $2`,
-		finalPrice, order.ID,
+		`UPDATE orders SET subtotal = $1, discount = $2, net_total = $3, tax_total = $4, final_price = $5 WHERE id = $6`,
+		order.Subtotal, order.Discount, order.Net, order.Tax, order.FinalPrice, order.ID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update final price for order ID %d: %w", order.ID, err)
 	}
 
-	// Set order details
-	order.FinalPrice = finalPrice
-	order.Items = orderReq.Items
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit order ID %d: %w", order.ID, err)
+	}
+	r.refreshProductStock(reserved)
 
-	// Invalidate and update cache
-	_ = r.invalidateAllOrdersCache()
+	// Cache the new order, once it is committed
 	_ = r.cache.SetOrderByID(order.ID, &order, 10*time.Minute)
+	if order.CustomerID.Valid {
+		_ = r.cache.InvalidateCustomerOrderPages(int(order.CustomerID.Int64))
+	}
+	if idempotencyKey.Valid {
+		record := models.IdempotencyRecord{OrderID: order.ID, RequestHash: requestHash}
+		_ = r.cache.SetIdempotencyRecord(orderReq.IdempotencyKey, &record, idempotencyKeyTTL)
+	}
 
 	return &order, nil
 }
 
-// invalidateAllOrdersCache refreshes the cache for all orders.
-func (r *OrderRepo) invalidateAllOrdersCache() error {
-	orders, err := r.fetchAllOrdersFromDB()
+// orderedProduct is what placing an order needs to know about one of its products.
+type orderedProduct struct {
+	name        string
+	category    string
+	basePrice   models.Money
+	nativePrice models.NullMoney
+	stock       sql.NullInt64
+	available   bool
+}
+
+// fetchOrderedProductsTx reads the products of the given items, with their native price in the
+// currency, and locks them until the transaction ends. Rows are locked in a consistent order so
+// concurrent orders cannot deadlock, and cannot oversell a product. Deleted products are left out.
+func fetchOrderedProductsTx(tx *sql.Tx, items []models.OrderItem, currency string) (map[int]orderedProduct, error) {
+	productIDs := make([]int64, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, int64(item.ProductID))
+	}
+
+	rows, err := tx.Query(
+		`SELECT p.id, p.name, p.category, p.price, pp.price, p.stock, p.is_available FROM products p
+		LEFT JOIN product_prices pp ON pp.product_id = p.id AND pp.currency = $2
+		WHERE p.id = ANY($1) AND p.deleted_at IS NULL
+		ORDER BY p.id
+		FOR UPDATE OF p`,
+		pq.Int64Array(productIDs), currency,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to refresh cache for all orders: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make(map[int]orderedProduct, len(items))
+	for rows.Next() {
+		var id int
+		var product orderedProduct
+		err := rows.Scan(&id, &product.name, &product.category, &product.basePrice, &product.nativePrice,
+			&product.stock, &product.available)
+		if err != nil {
+			return nil, err
+		}
+		products[id] = product
+	}
+	return products, rows.Err()
+}
+
+// reserveStockTx takes the quantities of the items that reserve stock from their products.
+func reserveStockTx(tx *sql.Tx, items []models.OrderItem) error {
+	var productIDs, quantities []int64
+	for _, item := range items {
+		if item.StockReserved {
+			productIDs = append(productIDs, int64(item.ProductID))
+			quantities = append(quantities, int64(item.Quantity))
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil
 	}
 
-	// Update Redis cache
-	return r.cache.SetAllOrders(orders, 10*time.Minute)
+	_, err := tx.Exec(
+		`UPDATE products p SET stock = p.stock - reserved.quantity
+		FROM unnest($1::int[], $2::int[]) AS reserved (product_id, quantity)
+		WHERE p.id = reserved.product_id`,
+		pq.Int64Array(productIDs), pq.Int64Array(quantities),
+	)
+	return err
 }
 
-// fetchAllOrdersFromDB retrieves all orders from the database.
-func (r *OrderRepo) fetchAllOrdersFromDB() ([]models.Order, error) {
-	rows, err := r.db.Query("SELECT id, coupon_code, final_price FROM orders")
+// orderItemColumns are the order_items columns written when an order is placed
+var orderItemColumns = []string{
+	"order_id", "product_id", "product_name", "quantity", "price",
+	"discount", "tax_rate", "tax_inclusive", "net_amount", "tax_amount", "gross_amount", "stock_reserved",
+}
+
+// insertOrderItemsTx inserts the items of an order with a single multi-row INSERT.
+func insertOrderItemsTx(tx *sql.Tx, items []models.OrderItem) error {
+	rows := make([]string, 0, len(items))
+	args := make([]any, 0, len(items)*len(orderItemColumns))
+	for _, item := range items {
+		placeholders := make([]string, len(orderItemColumns))
+		for i := range placeholders {
+			placeholders[i] = fmt.Sprintf("$%d", len(args)+i+1)
+		}
+		rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+		args = append(args,
+			item.OrderID, item.ProductID, item.ProductName, item.Quantity, item.Price,
+			item.Discount, item.TaxRate, item.TaxInclusive, item.Net, item.Tax, item.Gross, item.StockReserved,
+		)
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO order_items (`+strings.Join(orderItemColumns, ", ")+`) VALUES `+strings.Join(rows, ", "),
+		args...,
+	)
+	return err
+}
+
+// UpdateOrderStatus moves an order to a new status, recording who did it, and refreshes the cache.
+// Cancelling an order releases its coupon redemption.
+func (r *OrderRepo) UpdateOrderStatus(id int, statusReq models.OrderStatusRequest, changedBy string) (*models.Order, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the order so concurrent transitions are serialized
+	var current models.OrderStatus
+	err = tx.QueryRow(`SELECT status FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch status of order ID %d: %w", id, err)
+	}
+	if !current.CanTransitionTo(statusReq.Status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, current, statusReq.Status)
+	}
+
+	restored, err := transitionOrderStatusTx(tx, id, current, statusReq, changedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update status of order ID %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit status of order ID %d: %w", id, err)
+	}
+
+	r.refreshProductStock(restored)
+	return r.refreshOrderCache(id)
+}
+
+// CancelOrder cancels an order on behalf of its customer, provided the order is still pending
+// or was placed less than window ago, and refreshes the cache.
+func (r *OrderRepo) CancelOrder(id int, cancelReq models.CancelOrderRequest, changedBy string, window time.Duration) (*models.Order, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the order so the kitchen cannot accept it concurrently. The window is measured with
+	// the clock of the database, which set created_at.
+	order := models.Order{ID: id}
+	var createdAt sql.NullTime
+	var now time.Time
+	err = tx.QueryRow(`SELECT status, created_at, now() FROM orders WHERE id = $1 FOR UPDATE`, id).
+		Scan(&order.Status, &createdAt, &now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch status of order ID %d: %w", id, err)
+	}
+	order.CreatedAt = createdAt.Time
+	if !order.CanBeCancelledByCustomer(now, window) {
+		return nil, fmt.Errorf("%w: order is %s", ErrCancellationClosed, order.Status)
+	}
+
+	statusReq := models.OrderStatusRequest{Status: models.OrderStatusCancelled, Note: cancelReq.Reason}
+	restored, err := transitionOrderStatusTx(tx, id, order.Status, statusReq, changedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel order ID %d: %w", id, err)
+	}
+	if _, err := tx.Exec(`UPDATE orders SET cancellation_reason = $1 WHERE id = $2`, cancelReq.Reason, id); err != nil {
+		return nil, fmt.Errorf("failed to record cancellation reason of order ID %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit cancellation of order ID %d: %w", id, err)
+	}
+
+	r.refreshProductStock(restored)
+	return r.refreshOrderCache(id)
+}
+
+// FindIdempotencyRecord looks up the order placed with an idempotency key, attempting to use cache first.
+// It returns nil when no order was placed with that key.
+func (r *OrderRepo) FindIdempotencyRecord(key string) (*models.IdempotencyRecord, error) {
+	// Try Redis cache
+	cachedRecord, err := r.cache.GetIdempotencyRecord(key)
+	if err == nil {
+		return cachedRecord, nil
+	}
+
+	// Fallback to DB
+	var record models.IdempotencyRecord
+	err = r.db.QueryRow(`SELECT id, request_hash FROM orders WHERE idempotency_key = $1`, key).
+		Scan(&record.OrderID, &record.RequestHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch order by idempotency key: %w", err)
+	}
+
+	// Cache result (non-blocking)
+	_ = r.cache.SetIdempotencyRecord(key, &record, idempotencyKeyTTL)
+
+	return &record, nil
+}
+
+// GetOrderStatusHistory retrieves the status transitions of an order, oldest first.
+func (r *OrderRepo) GetOrderStatusHistory(id int) ([]models.OrderStatusChange, error) {
+	rows, err := r.db.Query(
+		`SELECT order_id, from_status, to_status, changed_by, note, changed_at
+		FROM order_status_history WHERE order_id = $1 ORDER BY id`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch status history of order ID %d: %w", id, err)
+	}
+	defer rows.Close()
+
+	history := []models.OrderStatusChange{}
+	for rows.Next() {
+		var change models.OrderStatusChange
+		err := rows.Scan(&change.OrderID, &change.FromStatus, &change.ToStatus, &change.ChangedBy, &change.Note, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// transitionOrderStatusTx stores the new status of a locked order and records the change.
+// Cancelling an order releases its coupon and gives its reserved stock back; the IDs of the
+// products whose stock was restored are returned.
+func transitionOrderStatusTx(tx *sql.Tx, id int, from models.OrderStatus, statusReq models.OrderStatusRequest, changedBy string) ([]int, error) {
+	if _, err := tx.Exec(`UPDATE orders SET status = $1 WHERE id = $2`, statusReq.Status, id); err != nil {
+		return nil, err
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, note) VALUES ($1, $2, $3, $4, $5)`,
+		id, from, statusReq.Status, changedBy, statusReq.Note,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusReq.Status != models.OrderStatusCancelled {
+		return nil, nil
+	}
+	if err := releaseCouponRedemptionTx(tx, id); err != nil {
+		return nil, err
+	}
+	return restoreStockTx(tx, id)
+}
+
+// restoreStockTx gives the stock reserved by an order back to its products, once.
+// Products that stopped being stock-tracked are left alone.
+func restoreStockTx(tx *sql.Tx, orderID int) ([]int, error) {
+	rows, err := tx.Query(
+		`WITH released AS (
+			UPDATE order_items SET stock_reserved = FALSE
+			WHERE order_id = $1 AND stock_reserved
+			RETURNING product_id, quantity
+		)
+		UPDATE products p SET stock = p.stock + r.quantity
+		FROM (SELECT product_id, SUM(quantity) AS quantity FROM released GROUP BY product_id) r
+		WHERE p.id = r.product_id AND p.stock IS NOT NULL
+		RETURNING p.id`,
+		orderID,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var orders []models.Order
+	var restored []int
 	for rows.Next() {
-		var order models.Order
-		if err := rows.Scan(&order.ID, &order.CouponCode, &order.FinalPrice); err != nil {
+		var productID int
+		if err := rows.Scan(&productID); err != nil {
 			return nil, err
 		}
-		orders = append(orders, order)
+		restored = append(restored, productID)
 	}
+	return restored, rows.Err()
+}
 
-	return orders, rows.Err()
+// refreshProductStock evicts products whose stock changed from the cache, along with the product pages.
+func (r *OrderRepo) refreshProductStock(productIDs []int) {
+	if len(productIDs) == 0 {
+		return
+	}
+	for _, id := range productIDs {
+		_ = r.productCache.DeleteProductByID(id)
+	}
+	_ = r.productCache.InvalidateProductPages()
 }
 
-// fetchOrderByIDFromDB retrieves a specific order by ID from the database.
+// refreshOrderCache reads an order from the database and stores it in the cache,
+// dropping the cached pages of its customer's orders.
+func (r *OrderRepo) refreshOrderCache(id int) (*models.Order, error) {
+	order, err := r.fetchOrderByIDFromDB(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch order by ID %d from database: %w", id, err)
+	}
+	_ = r.cache.SetOrderByID(id, order, 10*time.Minute)
+	if order.CustomerID.Valid {
+		_ = r.cache.InvalidateCustomerOrderPages(int(order.CustomerID.Int64))
+	}
+	return order, nil
+}
+
+// fetchPromoCodeTx retrieves the discount rule of a coupon within a transaction,
+// locking it so concurrent orders using the same code are serialized.
+// It returns nil when the code has no discount attached.
+func (r *OrderRepo) fetchPromoCodeTx(tx *sql.Tx, code string) (*models.PromoCode, error) {
+	return scanPromoCode(tx.QueryRow(selectPromoCodeQuery+" FOR UPDATE", code), code)
+}
+
+// redeemCouponTx records the use of a coupon by an order, enforcing the code's redemption limits.
+// The promo code row must have been locked by fetchPromoCodeTx beforehand.
+func (r *OrderRepo) redeemCouponTx(tx *sql.Tx, code string, promo *models.PromoCode, orderID int, customerID zero.Int) error {
+	if promo != nil {
+		if limit := promo.RedemptionLimit(); limit > 0 {
+			var redeemed int
+			err := tx.QueryRow(
+				`SELECT COUNT(*) FROM coupon_redemptions WHERE code = $1 AND released_at IS NULL`,
+				code,
+			).Scan(&redeemed)
+			if err != nil {
+				return err
+			}
+			if redeemed >= limit {
+				return ErrCouponRedemptionLimit
+			}
+		}
+
+		if limit := promo.MaxRedemptionsPerCustomer; limit > 0 && customerID.Valid {
+			var redeemed int
+			err := tx.QueryRow(
+				`SELECT COUNT(*) FROM coupon_redemptions WHERE code = $1 AND customer_id = $2 AND released_at IS NULL`,
+				code, customerID,
+			).Scan(&redeemed)
+			if err != nil {
+				return err
+			}
+			if redeemed >= limit {
+				return ErrCouponRedemptionLimit
+			}
+		}
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO coupon_redemptions (code, order_id, customer_id) VALUES ($1, $2, $3)`,
+		code, orderID, customerID,
+	)
+	return err
+}
+
+// releaseCouponRedemptionTx frees the coupon redemption held by an order within a transaction.
+func releaseCouponRedemptionTx(tx *sql.Tx, orderID int) error {
+	_, err := tx.Exec(
+		`UPDATE coupon_redemptions SET released_at = CURRENT_TIMESTAMP WHERE order_id = $1 AND released_at IS NULL`,
+		orderID,
+	)
+	return err
+}
+
+// fetchOrderByIDFromDB retrieves a specific order by ID, along with its items, from the database.
 func (r *OrderRepo) fetchOrderByIDFromDB(id int) (*models.Order, error) {
-	var order models.Order
-	err := r.db.QueryRow("SELECT id, coupon_code, final_price FROM orders WHERE id = $1", id).
-		Scan(&order.ID, &order.CouponCode, &order.FinalPrice)
+	rows, err := r.db.Query(
+		selectOrderWithItems+` FROM orders o `+joinOrderItems+` WHERE o.id = $1 ORDER BY i.id`,
+		id,
+	)
 	if err != nil {
 		return nil, err
 	}
-	return &order, nil
+
+	orders, err := scanOrdersWithItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &orders[0], nil
 }
 
-// CheckProductExists check if product with id exists
-func (r *OrderRepo) CheckProductExists(productID int) (bool, error) {
-	var exists bool
-	err := r.db.QueryRow(
-		`SELECT EXISTS(SELECT 1 FROM products WHERE id = $1)`,
-		productID,
-	).Scan(&exists)
-	return exists, err
+// isUniqueViolation reports whether err is a violation of the given unique index.
+func isUniqueViolation(err error, index string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == index
+}
+
+// selectOrderWithItems and joinOrderItems read orders aliased as o with their items,
+// one row per item, in the layout expected by scanOrdersWithItems
+const (
+	selectOrderWithItems = `SELECT o.id, o.customer_id, o.api_key_id, COALESCE(o.coupon_code, ''), o.subtotal, o.discount, o.net_total, o.tax_total, o.final_price,
+		o.currency, o.status, o.created_at, COALESCE(o.cancellation_reason, ''),
+		i.product_id, i.product_name, i.quantity, i.price,
+		i.discount, i.tax_rate, i.tax_inclusive, i.net_amount, i.tax_amount, i.gross_amount`
+	joinOrderItems = `LEFT JOIN order_items i ON i.order_id = o.id`
+)
+
+// scanOrdersWithItems groups consecutive rows of the same order into a single order and closes rows.
+func scanOrdersWithItems(rows *sql.Rows) ([]models.Order, error) {
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		var createdAt sql.NullTime // created_at has a default but is nullable
+		var productID, quantity sql.NullInt64
+		var productName sql.NullString
+		var taxInclusive sql.NullBool
+		var price, discount, taxRate, net, tax, gross models.NullMoney
+		err := rows.Scan(
+			&order.ID, &order.CustomerID, &order.APIKeyID, &order.CouponCode, &order.Subtotal, &order.Discount, &order.Net, &order.Tax, &order.FinalPrice,
+			&order.Currency, &order.Status, &createdAt, &order.CancellationReason,
+			&productID, &productName, &quantity, &price,
+			&discount, &taxRate, &taxInclusive, &net, &tax, &gross,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(orders) == 0 || orders[len(orders)-1].ID != order.ID {
+			order.CreatedAt = createdAt.Time
+			order.Items = []models.OrderItem{}
+			orders = append(orders, order)
+		}
+
+		// Orders without items come with a single row of NULL item columns
+		if productID.Valid {
+			last := &orders[len(orders)-1]
+			last.Items = append(last.Items, models.OrderItem{
+				ProductID:   int(productID.Int64),
+				ProductName: productName.String,
+				OrderID:     order.ID,
+				Quantity:    int(quantity.Int64),
+				Price:       price.Money,
+
+				Discount:     discount.Money,
+				TaxRate:      taxRate.Money,
+				TaxInclusive: taxInclusive.Bool,
+				Net:          net.Money,
+				Tax:          tax.Money,
+				Gross:        gross.Money,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		orders[i].Taxes = models.SummarizeTaxes(orders[i].Items)
+	}
+	return orders, nil
 }
@@ -2,14 +2,24 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
 	"order_food_online/internal/cache"
 	"order_food_online/internal/models"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type ProductRepository interface {
-	GetAllProducts() ([]models.Product, error)
+	ListProducts(query models.ProductQuery) (*models.ProductPage, error)
 	GetProductByID(id int) (*models.Product, error)
+	GetProductsByIDs(ids []int) ([]models.Product, error)
+	CreateProduct(productReq models.ProductRequest) (*models.Product, error)
+	UpdateProduct(id int, productReq models.ProductRequest) (*models.Product, error)
+	DeleteProduct(id int) error
+	SetStock(id int, stockReq models.StockRequest) (*models.Product, error)
+	ImportProducts(productReqs []models.ProductRequest) ([]models.Product, error)
 }
 
 type ProductRepo struct {
@@ -21,32 +31,23 @@ func NewProductRepository(db *sql.DB, cache cache.ProductCache) ProductRepositor
 	return &ProductRepo{db: db, cache: cache}
 }
 
-func (r *ProductRepo) GetAllProducts() ([]models.Product, error) {
+// ListProducts retrieves a page of products matching the query, attempting to use cache first.
+func (r *ProductRepo) ListProducts(query models.ProductQuery) (*models.ProductPage, error) {
 	// Try Redis cache first
-	cachedProducts, err := r.cache.GetAllProducts()
+	cachedPage, err := r.cache.GetProductPage(query)
 	if err == nil {
-		return cachedProducts, nil
+		return cachedPage, nil
 	}
 
 	// Fallback to DB
-	rows, err := r.db.Query("SELECT id, name, price, category FROM products")
+	page, err := r.fetchProductPageFromDB(query)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var products []models.Product
-	for rows.Next() {
-		var product models.Product
-		if err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.Category); err != nil {
-			return nil, err
-		}
-		products = append(products, product)
-	}
 
 	// Update Redis cache
-	r.cache.SetAllProducts(products, 10*time.Minute)
-	return products, nil
+	_ = r.cache.SetProductPage(query, page, 10*time.Minute)
+	return page, nil
 }
 
 func (r *ProductRepo) GetProductByID(id int) (*models.Product, error) {
@@ -58,8 +59,8 @@ func (r *ProductRepo) GetProductByID(id int) (*models.Product, error) {
 
 	// Fallback to DB
 	var p models.Product
-	err = r.db.QueryRow("SELECT id, name, price, category FROM products WHERE id = $1", id).
-		Scan(&p.ID, &p.Name, &p.Price, &p.Category)
+	err = r.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = $1 AND deleted_at IS NULL", id).
+		Scan(&p.ID, &p.Name, &p.Price, &p.Category, &p.Prices, &p.Stock, &p.Available)
 	if err != nil {
 		return nil, err
 	}
@@ -68,3 +69,391 @@ func (r *ProductRepo) GetProductByID(id int) (*models.Product, error) {
 	r.cache.SetProductByID(id, &p, 10*time.Minute)
 	return &p, nil
 }
+
+// GetProductsByIDs retrieves the products with the given IDs in a single query, bypassing the
+// cache. Unknown and deleted products are left out.
+func (r *ProductRepo) GetProductsByIDs(ids []int) ([]models.Product, error) {
+	productIDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		productIDs = append(productIDs, int64(id))
+	}
+
+	rows, err := r.db.Query("SELECT "+productColumns+" FROM products WHERE id = ANY($1) AND deleted_at IS NULL", pq.Int64Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		var p models.Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Category, &p.Prices, &p.Stock, &p.Available); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// CreateProduct inserts a new product along with its native prices and refreshes the cache.
+func (r *ProductRepo) CreateProduct(productReq models.ProductRequest) (product *models.Product, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	product, err = insertProduct(tx, productReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert product: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit product: %w", err)
+	}
+
+	r.refreshCache(product)
+	return product, nil
+}
+
+// UpdateProduct replaces the fields and native prices of an existing product and refreshes the cache.
+func (r *ProductRepo) UpdateProduct(id int, productReq models.ProductRequest) (_ *models.Product, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	product := models.Product{ID: id}
+	err = tx.QueryRow(
+		`UPDATE products SET name = $1, price = $2, category = $3
+		WHERE id = $4 AND deleted_at IS NULL
+		RETURNING name, price, category, `+productStockColumns,
+		productReq.Name, productReq.Price, productReq.Category, id,
+	).Scan(&product.Name, &product.Price, &product.Category, &product.Stock, &product.Available)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update product ID %d: %w", id, err)
+	}
+	if _, err = tx.Exec(`DELETE FROM product_prices WHERE product_id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to replace prices of product ID %d: %w", id, err)
+	}
+	if product.Prices, err = insertProductPrices(tx, id, productReq.Prices); err != nil {
+		return nil, fmt.Errorf("failed to replace prices of product ID %d: %w", id, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit product ID %d: %w", id, err)
+	}
+
+	r.refreshCache(&product)
+	return &product, nil
+}
+
+// DeleteProduct soft-deletes a product and evicts it from the cache.
+func (r *ProductRepo) DeleteProduct(id int) error {
+	result, err := r.db.Exec(
+		`UPDATE products SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete product ID %d: %w", id, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return fmt.Errorf("failed to delete product ID %d: %w", id, sql.ErrNoRows)
+	}
+
+	_ = r.cache.DeleteProductByID(id)
+	_ = r.cache.InvalidateProductPages()
+	return nil
+}
+
+// SetStock replaces the stock level and availability of a product and refreshes the cache.
+func (r *ProductRepo) SetStock(id int, stockReq models.StockRequest) (*models.Product, error) {
+	result, err := r.db.Exec(
+		`UPDATE products SET stock = $1, is_available = $2 WHERE id = $3 AND deleted_at IS NULL`,
+		stockReq.Stock, stockReq.Available, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update stock of product ID %d: %w", id, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, fmt.Errorf("failed to update stock of product ID %d: %w", id, sql.ErrNoRows)
+	}
+
+	// Read the product back with its prices
+	var product models.Product
+	err = r.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = $1", id).
+		Scan(&product.ID, &product.Name, &product.Price, &product.Category, &product.Prices, &product.Stock, &product.Available)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch product ID %d: %w", id, err)
+	}
+
+	r.refreshCache(&product)
+	return &product, nil
+}
+
+// ImportProducts inserts all products in a single transaction and refreshes the cache.
+func (r *ProductRepo) ImportProducts(productReqs []models.ProductRequest) (products []models.Product, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	products = make([]models.Product, 0, len(productReqs))
+	for i, productReq := range productReqs {
+		var product *models.Product
+		product, err = insertProduct(tx, productReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import product #%d: %w", i+1, err)
+		}
+		products = append(products, *product)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit product import: %w", err)
+	}
+
+	for i := range products {
+		_ = r.cache.SetProductByID(products[i].ID, &products[i], 10*time.Minute)
+	}
+	_ = r.cache.InvalidateProductPages()
+	return products, nil
+}
+
+// refreshCache stores the latest version of a product and drops the cached product pages.
+func (r *ProductRepo) refreshCache(product *models.Product) {
+	_ = r.cache.SetProductByID(product.ID, product, 10*time.Minute)
+	_ = r.cache.InvalidateProductPages()
+}
+
+// productSorts maps each sort order to the column it sorts on and its direction
+var productSorts = map[string]struct {
+	column string
+	desc   bool
+}{
+	models.ProductSortID:        {"id", false},
+	models.ProductSortName:      {"name", false},
+	models.ProductSortNameDesc:  {"name", true},
+	models.ProductSortPrice:     {"price", false},
+	models.ProductSortPriceDesc: {"price", true},
+}
+
+// effectivePrice is the price of a product in a currency, given the currency and its rate
+const effectivePrice = `COALESCE(
+	(SELECT pp.price FROM product_prices pp WHERE pp.product_id = products.id AND pp.currency = $%d),
+	ROUND(price * $%d, 2))`
+
+// likeEscaper escapes the wildcard characters of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// fetchProductPageFromDB retrieves a page of products using keyset pagination.
+func (r *ProductRepo) fetchProductPageFromDB(query models.ProductQuery) (*models.ProductPage, error) {
+	sort, ok := productSorts[query.Sort]
+	if !ok {
+		return nil, models.ErrInvalidProductSort
+	}
+
+	// Build the filters shared by the count and the page queries
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+	bind := func(expression string, values ...any) string {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		return fmt.Sprintf(expression, placeholders...)
+	}
+	where := func(condition string, values ...any) {
+		conditions = append(conditions, bind(condition, values...))
+	}
+
+	// Prices are filtered and sorted as shown in the query's price currency: the native price,
+	// else the base price converted and rounded to the cent as CurrencyConverter.Convert does.
+	// The expression is bound once it is used, as queries can't have unused parameters.
+	var price string
+	priceColumn := func() string {
+		if price == "" {
+			price = "price"
+			if query.PriceCurrency != "" {
+				var rate any
+				if query.PriceRate > 0 {
+					rate = query.PriceRate
+				}
+				price = bind(effectivePrice, query.PriceCurrency, rate)
+			}
+		}
+		return price
+	}
+	// Without a rate, products lacking a native price have no price in the currency. They
+	// match every price condition, so that pricing the page fails rather than leaves them out.
+	wherePrice := func(condition string, values ...any) {
+		condition = bind(condition, values...)
+		if query.PriceCurrency != "" && query.PriceRate == 0 {
+			condition = "(" + condition + " OR " + priceColumn() + " IS NULL)"
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if query.Category != "" {
+		where("category = $%d", query.Category)
+	}
+	if query.MinPrice.Valid {
+		wherePrice(priceColumn()+" >= $%d", query.MinPrice.Money)
+	}
+	if query.MaxPrice.Valid {
+		wherePrice(priceColumn()+" <= $%d", query.MaxPrice.Money)
+	}
+	if query.Search != "" {
+		where("name ILIKE $%d", "%"+likeEscaper.Replace(query.Search)+"%")
+	}
+
+	page := models.ProductPage{Items: []models.Product{}}
+	err := r.db.QueryRow("SELECT COUNT(*) FROM products WHERE "+strings.Join(conditions, " AND "), args...).
+		Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resume after the last product of the previous page
+	if query.Cursor != "" {
+		var cursor models.ProductCursor
+		if err := models.DecodeCursor(query.Cursor, &cursor); err != nil {
+			return nil, err
+		}
+		if cursor.Sort != query.Sort || cursor.Currency != query.PriceCurrency {
+			return nil, models.ErrInvalidCursor
+		}
+
+		operator := ">"
+		if sort.desc {
+			operator = "<"
+		}
+		switch sort.column {
+		case "id":
+			where("id "+operator+" $%d", cursor.ID)
+		case "name":
+			where("(name, id) "+operator+" ($%d, $%d)", cursor.Name, cursor.ID)
+		case "price":
+			wherePrice("("+priceColumn()+", id) "+operator+" ($%d, $%d)", cursor.Price, cursor.ID)
+		}
+	}
+
+	direction := "ASC"
+	if sort.desc {
+		direction = "DESC"
+	}
+	column := sort.column
+	if column == "price" {
+		column = priceColumn()
+	}
+	orderBy := fmt.Sprintf("%s %s", column, direction)
+	if sort.column != "id" {
+		orderBy += ", id " + direction
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	rows, err := r.db.Query(
+		fmt.Sprintf(
+			"SELECT "+productColumns+" FROM products WHERE %s ORDER BY %s LIMIT %d",
+			strings.Join(conditions, " AND "), orderBy, query.Limit+1,
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var product models.Product
+		if err := rows.Scan(
+			&product.ID, &product.Name, &product.Price, &product.Category, &product.Prices, &product.Stock, &product.Available,
+		); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) > query.Limit {
+		page.Items = page.Items[:query.Limit]
+		last := page.Items[len(page.Items)-1]
+		if query.PriceCurrency != "" {
+			last, err = models.CurrencyConverter{Currency: query.PriceCurrency, Rate: query.PriceRate}.Product(last)
+			if err != nil {
+				return nil, err
+			}
+		}
+		page.NextCursor, err = models.EncodeCursor(models.ProductCursor{
+			Sort:     query.Sort,
+			ID:       last.ID,
+			Name:     last.Name,
+			Price:    last.Price,
+			Currency: query.PriceCurrency,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &page, nil
+}
+
+// productStockColumns selects the stock of a product and whether it can be ordered
+const productStockColumns = `stock, is_available AND (stock IS NULL OR stock > 0)`
+
+// productColumns selects a product along with its native prices, as a JSON object, and its stock
+const productColumns = `id, name, price, category,
+	(SELECT json_object_agg(pp.currency, pp.price) FROM product_prices pp WHERE pp.product_id = products.id),
+	` + productStockColumns
+
+func insertProduct(tx *sql.Tx, productReq models.ProductRequest) (*models.Product, error) {
+	var product models.Product
+	err := tx.QueryRow(
+		`INSERT INTO products (name, price, category) VALUES ($1, $2, $3)
+		RETURNING id, name, price, category, `+productStockColumns,
+		productReq.Name, productReq.Price, productReq.Category,
+	).Scan(&product.ID, &product.Name, &product.Price, &product.Category, &product.Stock, &product.Available)
+	if err != nil {
+		return nil, err
+	}
+	if product.Prices, err = insertProductPrices(tx, product.ID, productReq.Prices); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// insertProductPrices stores the native prices of a product and returns them.
+func insertProductPrices(tx *sql.Tx, productID int, prices models.Prices) (models.Prices, error) {
+	for currency, price := range prices {
+		_, err := tx.Exec(
+			`INSERT INTO product_prices (product_id, currency, price) VALUES ($1, $2, $3)`,
+			productID, currency, price,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert %s price: %w", currency, err)
+		}
+	}
+	if len(prices) == 0 {
+		return nil, nil
+	}
+	return prices, nil
+}
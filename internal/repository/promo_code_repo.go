@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"order_food_online/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// selectPromoCodeQuery reads the discount rule attached to a coupon code
+const selectPromoCodeQuery = `SELECT discount_type, discount_value, COALESCE(free_product_id, 0), COALESCE(max_discount, 0),
+	COALESCE(max_redemptions, 0), COALESCE(max_redemptions_per_customer, 0), single_use,
+	starts_at, ends_at, min_order_value, allowed_categories, allowed_product_ids
+	FROM promo_codes WHERE code = $1`
+
+type PromoCodeRepository interface {
+	GetPromoCode(code string) (*models.PromoCode, error)
+}
+
+type PromoCodeRepo struct {
+	db *sql.DB
+}
+
+func NewPromoCodeRepository(db *sql.DB) PromoCodeRepository {
+	return &PromoCodeRepo{db: db}
+}
+
+// GetPromoCode retrieves the discount rule of a coupon. It returns nil when the code has no discount attached.
+func (r *PromoCodeRepo) GetPromoCode(code string) (*models.PromoCode, error) {
+	return scanPromoCode(r.db.QueryRow(selectPromoCodeQuery, code), code)
+}
+
+// scanPromoCode reads a row produced by selectPromoCodeQuery.
+func scanPromoCode(row *sql.Row, code string) (*models.PromoCode, error) {
+	promo := models.PromoCode{Code: code, IsValid: true}
+	var categories pq.StringArray
+	var productIDs pq.Int64Array
+	err := row.Scan(
+		&promo.DiscountType, &promo.DiscountValue, &promo.FreeProductID, &promo.MaxDiscount,
+		&promo.MaxRedemptions, &promo.MaxRedemptionsPerCustomer, &promo.SingleUse,
+		&promo.StartsAt, &promo.EndsAt, &promo.MinOrderValue, &categories, &productIDs,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	promo.AllowedCategories = categories
+	for _, id := range productIDs {
+		promo.AllowedProductIDs = append(promo.AllowedProductIDs, int(id))
+	}
+	return &promo, nil
+}
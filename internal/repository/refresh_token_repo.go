@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"order_food_online/internal/models"
+	"time"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token has expired")
+	ErrRefreshTokenRevoked  = errors.New("refresh token was revoked")
+	// ErrRefreshTokenReused is returned when a token that was already rotated is presented again,
+	// which means it leaked: every token of its family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(token models.RefreshToken) error
+	RotateRefreshToken(tokenHash string, next models.RefreshToken) (*models.RefreshToken, error)
+	RevokeRefreshTokenFamily(tokenHash string) error
+}
+
+type RefreshTokenRepo struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) RefreshTokenRepository {
+	return &RefreshTokenRepo{db: db}
+}
+
+// CreateRefreshToken stores the first token of a family.
+func (r *RefreshTokenRepo) CreateRefreshToken(token models.RefreshToken) error {
+	_, err := r.db.Exec(
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)`,
+		token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	return nil
+}
+
+// RotateRefreshToken replaces the token with the given hash by next, which joins its family
+// and user. It returns next with those filled in. Presenting a token that was already replaced
+// revokes its whole family and returns ErrRefreshTokenReused.
+func (r *RefreshTokenRepo) RotateRefreshToken(tokenHash string, next models.RefreshToken) (_ *models.RefreshToken, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		// Revoking a reused family must stick even though the rotation fails
+		if err == nil || errors.Is(err, ErrRefreshTokenReused) {
+			if commitErr := tx.Commit(); commitErr != nil && err == nil {
+				err = fmt.Errorf("failed to commit refresh token rotation: %w", commitErr)
+			}
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	var current models.RefreshToken
+	var replacedBy sql.NullInt64
+	err = tx.QueryRow(
+		`SELECT id, user_id, family_id, expires_at, revoked_at, replaced_by FROM refresh_tokens
+		WHERE token_hash = $1 FOR UPDATE`,
+		tokenHash,
+	).Scan(&current.ID, &current.UserID, &current.FamilyID, &current.ExpiresAt, &current.RevokedAt, &replacedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch refresh token: %w", err)
+	}
+
+	switch {
+	case replacedBy.Valid:
+		if _, err = tx.Exec(
+			`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`,
+			current.FamilyID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	case current.RevokedAt != nil:
+		return nil, ErrRefreshTokenRevoked
+	case time.Now().After(current.ExpiresAt):
+		return nil, ErrRefreshTokenExpired
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	if err = tx.QueryRow(
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4) RETURNING id`,
+		next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt,
+	).Scan(&next.ID); err != nil {
+		return nil, fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	if _, err = tx.Exec(
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $2 WHERE id = $1`,
+		current.ID, next.ID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return &next, nil
+}
+
+// RevokeRefreshTokenFamily revokes the token with the given hash along with every token
+// rotated from the same login. Unknown tokens are ignored.
+func (r *RefreshTokenRepo) RevokeRefreshTokenFamily(tokenHash string) error {
+	_, err := r.db.Exec(
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1) AND revoked_at IS NULL`,
+		tokenHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
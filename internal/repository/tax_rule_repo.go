@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"order_food_online/internal/models"
+)
+
+type TaxRuleRepository interface {
+	ListRules() ([]models.TaxRule, error)
+	SetRule(rule models.TaxRule) (*models.TaxRule, error)
+	DeleteRule(category string) error
+}
+
+type TaxRuleRepo struct {
+	db *sql.DB
+}
+
+func NewTaxRuleRepository(db *sql.DB) TaxRuleRepository {
+	return &TaxRuleRepo{db: db}
+}
+
+// ListRules retrieves every tax rule, ordered by category.
+func (r *TaxRuleRepo) ListRules() ([]models.TaxRule, error) {
+	rules, err := fetchTaxRules(r.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tax rules: %w", err)
+	}
+	return rules, nil
+}
+
+// SetRule inserts or replaces the tax rule of a category.
+func (r *TaxRuleRepo) SetRule(rule models.TaxRule) (*models.TaxRule, error) {
+	_, err := r.db.Exec(
+		`INSERT INTO tax_rules (category, rate, inclusive) VALUES ($1, $2, $3)
+		ON CONFLICT (category) DO UPDATE SET rate = EXCLUDED.rate, inclusive = EXCLUDED.inclusive, updated_at = CURRENT_TIMESTAMP`,
+		rule.Category, rule.Rate, rule.Inclusive,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save tax rule for %s: %w", rule.Category, err)
+	}
+	return &rule, nil
+}
+
+// DeleteRule removes the tax rule of a category.
+func (r *TaxRuleRepo) DeleteRule(category string) error {
+	result, err := r.db.Exec(`DELETE FROM tax_rules WHERE category = $1`, category)
+	if err != nil {
+		return fmt.Errorf("failed to delete tax rule for %s: %w", category, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return fmt.Errorf("failed to delete tax rule for %s: %w", category, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// fetchTaxRules reads every tax rule, ordered by category.
+func fetchTaxRules(q querier) ([]models.TaxRule, error) {
+	rows, err := q.Query(`SELECT category, rate, inclusive FROM tax_rules ORDER BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.TaxRule{}
+	for rows.Next() {
+		var rule models.TaxRule
+		if err := rows.Scan(&rule.Category, &rule.Rate, &rule.Inclusive); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"order_food_online/internal/models"
+)
+
+// ErrDuplicateEmail is returned when an account already uses the email
+var ErrDuplicateEmail = errors.New("email is already registered")
+
+type UserRepository interface {
+	CreateUser(user models.User) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	GetUserByID(id int) (*models.User, error)
+	SetUserRole(id int, role string) (*models.User, error)
+	GrantFirstRole(id int, role string) (bool, error)
+}
+
+type UserRepo struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) UserRepository {
+	return &UserRepo{db: db}
+}
+
+// CreateUser inserts a user, whose email must already be normalized.
+func (r *UserRepo) CreateUser(user models.User) (*models.User, error) {
+	err := r.db.QueryRow(
+		`INSERT INTO users (email, name, role, password_hash) VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		user.Email, user.Name, user.Role, user.PasswordHash,
+	).Scan(&user.ID, &user.CreatedAt)
+	if isUniqueViolation(err, "users_email_idx") {
+		return nil, ErrDuplicateEmail
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUserByEmail retrieves the user with the given normalized email.
+func (r *UserRepo) GetUserByEmail(email string) (*models.User, error) {
+	return r.getUser(`WHERE email = $1`, email)
+}
+
+// GetUserByID retrieves a user by ID.
+func (r *UserRepo) GetUserByID(id int) (*models.User, error) {
+	return r.getUser(`WHERE id = $1`, id)
+}
+
+// SetUserRole changes the role of a user.
+func (r *UserRepo) SetUserRole(id int, role string) (*models.User, error) {
+	var user models.User
+	err := r.db.QueryRow(
+		`UPDATE users SET role = $2 WHERE id = $1 RETURNING id, email, name, role, password_hash, created_at`,
+		id, role,
+	).Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.PasswordHash, &user.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set role of user ID %d: %w", id, err)
+	}
+	return &user, nil
+}
+
+// GrantFirstRole gives a role to a user, unless some user already has it. It reports whether
+// the role was given.
+func (r *UserRepo) GrantFirstRole(id int, role string) (bool, error) {
+	result, err := r.db.Exec(
+		`UPDATE users SET role = $2 WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM users WHERE role = $2)`,
+		id, role,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to grant role to user ID %d: %w", id, err)
+	}
+	granted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to grant role to user ID %d: %w", id, err)
+	}
+	return granted == 1, nil
+}
+
+func (r *UserRepo) getUser(where string, arg interface{}) (*models.User, error) {
+	var user models.User
+	err := r.db.QueryRow(`SELECT id, email, name, role, password_hash, created_at FROM users `+where, arg).
+		Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.PasswordHash, &user.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	return &user, nil
+}
@@ -6,8 +6,12 @@ import (
 	"github.com/labstack/echo/v4"
 	echo_middleware "github.com/labstack/echo/v4/middleware"
 	"log"
+	"log/slog"
 	"net/http"
+	"order_food_online/config"
 	"order_food_online/internal/handlers"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
 	"order_food_online/pkg/middleware"
 	"os"
 	"os/signal"
@@ -19,8 +23,22 @@ func StartServer(
 	e *echo.Echo,
 	productHandler *handlers.ProductHandler,
 	orderHandler *handlers.OrderHandler,
+	promoCodeHandler *handlers.PromoCodeHandler,
+	currencyHandler *handlers.CurrencyHandler,
+	taxHandler *handlers.TaxHandler,
+	authHandler *handlers.AuthHandler,
+	apiKeyHandler *handlers.APIKeyHandler,
+	cartHandler *handlers.CartHandler,
+	promoCodeService *services.PromoCodeService,
+	currencyService *services.CurrencyService,
+	apiKeyService *services.APIKeyService,
+	verifier *auth.Verifier,
 	db *sql.DB,
+	logger *slog.Logger,
 ) {
+	// Report every error in the same envelope
+	e.HTTPErrorHandler = handlers.NewHTTPErrorHandler(logger)
+
 	// Register routes
 	e.GET("/health", func(c echo.Context) error {
 		return c.String(200, "OK")
@@ -28,10 +46,33 @@ func StartServer(
 
 	productHandler.RegisterProductRoutes(e)
 	orderHandler.RegisterOrderRoutes(e)
+	promoCodeHandler.RegisterPromoCodeRoutes(e)
+	currencyHandler.RegisterCurrencyRoutes(e)
+	taxHandler.RegisterTaxRoutes(e)
+	authHandler.RegisterAuthRoutes(e)
+	apiKeyHandler.RegisterAPIKeyRoutes(e)
+	cartHandler.RegisterCartRoutes(e)
 
 	e.Use(echo_middleware.Logger())
 	e.Use(echo_middleware.Recover())
-	e.Use(middleware.AuthMiddleware())
+	e.Use(middleware.APIKeyMiddleware(apiKeyService))
+	e.Use(middleware.AuthMiddleware(verifier, config.PublicRoutes()))
+
+	// Seed exchange rates from a local file, if one is configured
+	if path := os.Getenv("EXCHANGE_RATES_FILE"); path != "" {
+		if err := currencyService.LoadRatesFile(path); err != nil {
+			logger.Error("Failed to load exchange rates", slog.String("path", path), "error", err)
+		}
+	}
+
+	// Reload coupon bases when they change on disk
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go func() {
+		if err := promoCodeService.WatchCoupons(watchCtx); err != nil {
+			logger.Error("Coupon hot reload disabled", "error", err)
+		}
+	}()
 
 	// Start the server
 	port := getPort()
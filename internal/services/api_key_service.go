@@ -0,0 +1,117 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/pkg/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to spot
+const apiKeyPrefix = "ofo_"
+
+// apiKeyDisplayLength is how many characters of a key are kept to tell keys apart
+const apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+type APIKeyService struct {
+	repo   repository.APIKeyRepository
+	logger *slog.Logger
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, logger *slog.Logger) *APIKeyService {
+	return &APIKeyService{repo: repo, logger: logger}
+}
+
+// CreateAPIKey generates an API key granting the requested permissions. The key itself is
+// only returned here: the API keeps its hash.
+func (s *APIKeyService) CreateAPIKey(req models.CreateAPIKeyRequest, createdBy string) (*models.CreatedAPIKey, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	var errs models.ValidationErrors
+	if req.Name == "" || len(req.Name) > 100 {
+		errs.Add("name", "must be between 1 and 100 characters long")
+	}
+	if len(req.Scopes) == 0 {
+		errs.Add("scopes", "must grant at least one permission")
+	}
+	for i, scope := range req.Scopes {
+		if !auth.IsPermission(scope) {
+			errs.Add(fmt.Sprintf("scopes[%d]", i), "must be a known permission")
+		}
+	}
+	if req.ExpiresAt.Valid && !req.ExpiresAt.Time.After(time.Now()) {
+		errs.Add("expires_at", "must be in the future")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	key, err := s.repo.CreateAPIKey(models.APIKey{
+		Name:      req.Name,
+		Prefix:    secret[:apiKeyDisplayLength],
+		Scopes:    req.Scopes,
+		CreatedBy: createdBy,
+		ExpiresAt: req.ExpiresAt,
+		KeyHash:   hashToken(secret),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.CreatedAPIKey{APIKey: *key, Key: secret}, nil
+}
+
+func (s *APIKeyService) ListAPIKeys() ([]models.APIKey, error) {
+	return s.repo.ListAPIKeys()
+}
+
+// RevokeAPIKey revokes a key, which is rejected from then on.
+func (s *APIKeyService) RevokeAPIKey(id int) error {
+	return s.repo.RevokeAPIKey(id)
+}
+
+// AuthenticateAPIKey returns the principal an API key authenticates, and records its use.
+// The principal is granted the key's scopes and no role.
+func (s *APIKeyService) AuthenticateAPIKey(secret string) (*auth.Principal, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	key, err := s.repo.GetAPIKeyByHash(hashToken(secret))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt.Valid {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if !key.Active(now) {
+		return nil, auth.ErrAPIKeyExpired
+	}
+
+	if err := s.repo.TouchAPIKey(key.ID, now); err != nil {
+		s.logger.Warn("Failed to record API key use", slog.Int("apiKeyID", key.ID), "error", err)
+	}
+	return &auth.Principal{
+		Subject:   "api_key:" + strconv.Itoa(key.ID),
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		ExpiresAt: key.ExpiresAt.Time,
+		APIKeyID:  key.ID,
+	}, nil
+}
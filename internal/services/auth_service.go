@@ -0,0 +1,211 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"order_food_online/config"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/pkg/auth"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmailTaken          = errors.New("an account already uses this email")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+)
+
+// dummyPasswordHash is compared against when no account matches a login, so logins take
+// as long whether or not the email is registered
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("order_food_online"), bcrypt.DefaultCost)
+
+type AuthService struct {
+	users           repository.UserRepository
+	refreshTokens   repository.RefreshTokenRepository
+	issuer          *auth.TokenIssuer
+	refreshTokenTTL time.Duration
+	bootstrapAdmin  string // email of the account that becomes the first platform admin
+	logger          *slog.Logger
+}
+
+func NewAuthService(
+	users repository.UserRepository,
+	refreshTokens repository.RefreshTokenRepository,
+	issuer *auth.TokenIssuer,
+	logger *slog.Logger,
+) *AuthService {
+	return &AuthService{
+		users:           users,
+		refreshTokens:   refreshTokens,
+		issuer:          issuer,
+		refreshTokenTTL: config.RefreshTokenTTL(),
+		bootstrapAdmin:  config.BootstrapAdminEmail(),
+		logger:          logger,
+	}
+}
+
+// IssuesTokens reports whether the API issues tokens to customer accounts. It doesn't when it
+// only accepts the tokens of an external issuer.
+func (s *AuthService) IssuesTokens() bool {
+	return s.issuer != nil
+}
+
+// Register creates a customer account, hashing its password with bcrypt.
+func (s *AuthService) Register(req models.RegisterRequest) (*models.User, error) {
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	user, err := s.users.CreateUser(models.User{Email: req.Email, Name: req.Name, Role: auth.RoleCustomer, PasswordHash: string(hash)})
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		return nil, ErrEmailTaken
+	}
+	return user, err
+}
+
+// Login checks a customer's credentials and starts a new family of refresh tokens.
+func (s *AuthService) Login(req models.LoginRequest) (*models.TokenPair, error) {
+	user, err := s.users.GetUserByEmail(models.NormalizeEmail(req.Email))
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.grantBootstrapAdmin(user); err != nil {
+		return nil, err
+	}
+
+	refreshToken, stored, err := s.newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	stored.UserID = user.ID
+	if stored.FamilyID, err = randomHex(16); err != nil {
+		return nil, err
+	}
+	if err := s.refreshTokens.CreateRefreshToken(stored); err != nil {
+		return nil, err
+	}
+	return s.tokenPair(user, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// The presented token can't be used again; presenting it twice revokes every token of the login.
+func (s *AuthService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	nextToken, next, err := s.newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.refreshTokens.RotateRefreshToken(hashToken(refreshToken), next)
+	switch {
+	case errors.Is(err, repository.ErrRefreshTokenReused):
+		s.logger.Warn("Refresh token reused, revoked its family")
+		return nil, ErrInvalidRefreshToken
+	case errors.Is(err, repository.ErrRefreshTokenNotFound),
+		errors.Is(err, repository.ErrRefreshTokenRevoked),
+		errors.Is(err, repository.ErrRefreshTokenExpired):
+		return nil, ErrInvalidRefreshToken
+	case err != nil:
+		return nil, err
+	}
+
+	user, err := s.users.GetUserByID(rotated.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return s.tokenPair(user, nextToken)
+}
+
+// Logout revokes the refresh token and every token rotated from the same login.
+func (s *AuthService) Logout(refreshToken string) error {
+	return s.refreshTokens.RevokeRefreshTokenFamily(hashToken(refreshToken))
+}
+
+// SetRole assigns a role to an account. The account's tokens carry the new role once refreshed.
+func (s *AuthService) SetRole(userID int, req models.RoleRequest) (*models.User, error) {
+	if !auth.IsRole(req.Role) {
+		return nil, models.ValidationErrors{{Field: "role", Message: "must be one of " + strings.Join(auth.Roles, ", ")}}
+	}
+	return s.users.SetUserRole(userID, req.Role)
+}
+
+// grantBootstrapAdmin makes the account of BOOTSTRAP_ADMIN_EMAIL a platform admin when it logs
+// in while there is no platform admin yet. This is how the first admin is created: the others
+// are given their role by an admin.
+func (s *AuthService) grantBootstrapAdmin(user *models.User) error {
+	if s.bootstrapAdmin == "" || user.Email != s.bootstrapAdmin || user.Role == auth.RolePlatformAdmin {
+		return nil
+	}
+	granted, err := s.users.GrantFirstRole(user.ID, auth.RolePlatformAdmin)
+	if err != nil {
+		return err
+	}
+	if granted {
+		s.logger.Warn("Made the bootstrap account the first platform admin", slog.Int("userID", user.ID))
+		user.Role = auth.RolePlatformAdmin
+	}
+	return nil
+}
+
+// tokenPair issues an access token for the user alongside the given refresh token.
+func (s *AuthService) tokenPair(user *models.User, refreshToken string) (*models.TokenPair, error) {
+	accessToken, err := s.issuer.Issue(auth.Principal{
+		Subject: auth.UserSubject(user.ID),
+		Name:    user.Name,
+		Roles:   []string{user.Role},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue access token: %w", err)
+	}
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.issuer.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// newRefreshToken generates a random refresh token and the record storing its hash.
+func (s *AuthService) newRefreshToken() (string, models.RefreshToken, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", models.RefreshToken{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	return token, models.RefreshToken{TokenHash: hashToken(token), ExpiresAt: time.Now().Add(s.refreshTokenTTL)}, nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash under which a refresh token is stored.
+// Refresh tokens are random, so they need no salt nor slow hash.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(n int) (string, error) {
+	random := make([]byte, n)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate random ID: %w", err)
+	}
+	return hex.EncodeToString(random), nil
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"order_food_online/config"
+	"order_food_online/internal/cache"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"time"
+
+	"github.com/guregu/null/zero"
+)
+
+// ErrCartItemNotFound is returned when changing a product that is not in the cart
+var ErrCartItemNotFound = errors.New("product is not in the cart")
+
+// CouponRejectedError is returned when the coupon of a cart does not apply to it.
+type CouponRejectedError struct {
+	Reason string
+}
+
+func (e *CouponRejectedError) Error() string {
+	return models.CouponReasonMessage(e.Reason)
+}
+
+// UnavailableItemsError is returned when checking out a cart with lines that can't be ordered,
+// because their product sold out or left the catalog.
+type UnavailableItemsError struct {
+	Lines []UnavailableLine
+}
+
+// UnavailableLine is a line of a cart that can't be ordered.
+type UnavailableLine struct {
+	Line      int // index of the line in the cart
+	ProductID int
+	Reason    string
+}
+
+func (e *UnavailableItemsError) Error() string {
+	return fmt.Sprintf("%d products of the cart can't be ordered", len(e.Lines))
+}
+
+type CartService struct {
+	cache       cache.CartCache
+	productRepo repository.ProductRepository
+	promoCodes  *PromoCodeService
+	orders      *OrderService
+	currencies  *CurrencyService
+	ttl         time.Duration
+	logger      *slog.Logger
+}
+
+func NewCartService(
+	cache cache.CartCache,
+	productRepo repository.ProductRepository,
+	promoCodes *PromoCodeService,
+	orders *OrderService,
+	currencies *CurrencyService,
+	logger *slog.Logger,
+) *CartService {
+	return &CartService{
+		cache:       cache,
+		productRepo: productRepo,
+		promoCodes:  promoCodes,
+		orders:      orders,
+		currencies:  currencies,
+		ttl:         config.CartTTL(),
+		logger:      logger,
+	}
+}
+
+// NewGuestID returns an ID for the cart of an anonymous visitor.
+func (s *CartService) NewGuestID() (string, error) {
+	return randomHex(16)
+}
+
+// GetCart returns the cart of the owner priced in the given currency, the base currency by
+// default. Owners without a cart get an empty one.
+func (s *CartService) GetCart(owner models.CartOwner, currency string) (*models.CartView, error) {
+	cart, err := s.load(owner)
+	if err != nil {
+		return nil, err
+	}
+	return s.price(owner, cart, currency)
+}
+
+// AddItem adds units of a product to the cart. Products that are sold out can't be added.
+func (s *CartService) AddItem(owner models.CartOwner, req models.CartItemRequest, currency string) (*models.CartView, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	product, err := s.productRepo.GetProductByID(req.ProductID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrProductNotFound, req.ProductID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !product.CanOrder(req.Quantity) {
+		return nil, &repository.OutOfStockError{ProductID: product.ID, ProductName: product.Name}
+	}
+
+	return s.update(owner, currency, func(cart *models.Cart) error {
+		return cart.AddItem(req.ProductID, req.Quantity)
+	})
+}
+
+// SetItemQuantity changes the quantity of a product already in the cart.
+func (s *CartService) SetItemQuantity(owner models.CartOwner, req models.CartItemRequest, currency string) (*models.CartView, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return s.update(owner, currency, func(cart *models.Cart) error {
+		if !cart.SetQuantity(req.ProductID, req.Quantity) {
+			return ErrCartItemNotFound
+		}
+		return nil
+	})
+}
+
+// RemoveItem removes a product from the cart.
+func (s *CartService) RemoveItem(owner models.CartOwner, productID int, currency string) (*models.CartView, error) {
+	return s.update(owner, currency, func(cart *models.Cart) error {
+		if !cart.RemoveItem(productID) {
+			return ErrCartItemNotFound
+		}
+		return nil
+	})
+}
+
+// ApplyCoupon applies a coupon to the cart, if it applies to the cart's current content.
+func (s *CartService) ApplyCoupon(owner models.CartOwner, code string, currency string) (*models.CartView, error) {
+	return s.update(owner, currency, func(cart *models.Cart) error {
+		quote, err := s.promoCodes.ValidatePromo(code, cart.OrderItems(), currency)
+		if err != nil {
+			return err
+		}
+		if !quote.Valid {
+			return &CouponRejectedError{Reason: quote.Reason}
+		}
+		cart.CouponCode = code
+		return nil
+	})
+}
+
+// RemoveCoupon removes the coupon of the cart, if it has one.
+func (s *CartService) RemoveCoupon(owner models.CartOwner, currency string) (*models.CartView, error) {
+	return s.update(owner, currency, func(cart *models.Cart) error {
+		cart.CouponCode = ""
+		return nil
+	})
+}
+
+// MergeGuestCart moves the cart an anonymous visitor filled before logging in into the cart of
+// their account.
+func (s *CartService) MergeGuestCart(guestID string, userID int) error {
+	guest, owner := models.CartOwner{GuestID: guestID}, models.CartOwner{UserID: userID}
+	return s.cache.MergeCart(guest, owner, s.ttl, func(cart, guestCart *models.Cart) error {
+		cart.Merge(guestCart)
+		return stamp(cart)
+	})
+}
+
+// Checkout places an order for the content of the cart, on behalf of the customer who owns it
+// or of the partner API key it is used with, and empties the cart. Checking out the same cart again returns the same order. Carts with
+// lines that can't be ordered are rejected with an UnavailableItemsError: the customer removes
+// them before checking out.
+func (s *CartService) Checkout(owner models.CartOwner, currency string) (*models.Order, error) {
+	cart, err := s.load(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	orderReq := models.OrderRequest{Items: cart.OrderItems(), Currency: currency}
+	orderReq.Normalize()
+	if err := orderReq.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkAvailable(cart); err != nil {
+		return nil, err
+	}
+	if owner.UserID != 0 {
+		orderReq.CustomerID = zero.IntFrom(int64(owner.UserID))
+	}
+	if owner.APIKeyID != 0 {
+		orderReq.APIKeyID = zero.IntFrom(int64(owner.APIKeyID))
+	}
+	orderReq.IdempotencyKey = "cart-" + cart.Revision
+
+	if cart.CouponCode != "" {
+		quote, err := s.promoCodes.ValidatePromo(cart.CouponCode, orderReq.Items, orderReq.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if !quote.Valid {
+			return nil, &CouponRejectedError{Reason: quote.Reason}
+		}
+		orderReq.CouponCode = zero.StringFrom(cart.CouponCode)
+	}
+
+	order, err := s.orders.PlaceOrder(orderReq)
+	if err != nil {
+		return nil, err
+	}
+	// A cart changed while checking out is kept for the next order
+	err = s.cache.DeleteCart(owner, cart.Revision)
+	if errors.Is(err, cache.ErrCartChanged) {
+		s.logger.Info("Cart changed during checkout, kept it", slog.String("cart", owner.Key()), slog.Int("orderID", order.ID))
+	} else if err != nil {
+		s.logger.Warn("Failed to empty cart after checkout", slog.String("cart", owner.Key()), slog.Int("orderID", order.ID), "error", err)
+	}
+	return order, nil
+}
+
+// checkAvailable checks every line of the cart can be ordered.
+func (s *CartService) checkAvailable(cart *models.Cart) error {
+	products, err := s.products(cart)
+	if err != nil {
+		return err
+	}
+	var unavailable UnavailableItemsError
+	for i, item := range cart.Items {
+		product, ok := products[item.ProductID]
+		switch {
+		case !ok:
+			unavailable.Lines = append(unavailable.Lines, UnavailableLine{Line: i, ProductID: item.ProductID, Reason: fmt.Sprintf("product with ID %d is no longer on the menu", item.ProductID)})
+		case !product.CanOrder(item.Quantity):
+			unavailable.Lines = append(unavailable.Lines, UnavailableLine{Line: i, ProductID: item.ProductID, Reason: product.Name + " is sold out"})
+		}
+	}
+	if len(unavailable.Lines) > 0 {
+		return &unavailable
+	}
+	return nil
+}
+
+// load returns the cart of the owner, or an empty cart when there is none.
+func (s *CartService) load(owner models.CartOwner) (*models.Cart, error) {
+	if owner.IsZero() {
+		return &models.Cart{Items: []models.CartItem{}}, nil
+	}
+	cart, err := s.cache.GetCart(owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cart: %w", err)
+	}
+	if cart == nil {
+		cart = &models.Cart{Items: []models.CartItem{}}
+	}
+	return cart, nil
+}
+
+// stamp gives a changed cart a new revision.
+func stamp(cart *models.Cart) error {
+	revision, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	cart.Revision = revision
+	cart.UpdatedAt = time.Now()
+	return nil
+}
+
+// update applies a change to the cart of the owner and returns the priced cart. The change is
+// applied again should another request change the cart meanwhile. Every change keeps the cart
+// for another TTL.
+func (s *CartService) update(owner models.CartOwner, currency string, change func(*models.Cart) error) (*models.CartView, error) {
+	if _, err := s.currencies.Converter(currency); err != nil {
+		return nil, err
+	}
+	cart, err := s.cache.UpdateCart(owner, s.ttl, func(cart *models.Cart) error {
+		if err := change(cart); err != nil {
+			return err
+		}
+		return stamp(cart)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.price(owner, cart, currency)
+}
+
+// price prices the cart at current catalog prices, and works out the discount of its coupon.
+func (s *CartService) price(owner models.CartOwner, cart *models.Cart, currencyCode string) (*models.CartView, error) {
+	currency, err := s.currencies.Converter(currencyCode)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &models.CartView{
+		GuestID:    owner.GuestID,
+		Items:      make([]models.CartLine, 0, len(cart.Items)),
+		CouponCode: cart.CouponCode,
+		Currency:   currency.Currency,
+		Revision:   cart.Revision,
+		UpdatedAt:  cart.UpdatedAt,
+	}
+	products, err := s.products(cart)
+	if err != nil {
+		return nil, err
+	}
+	available := make([]models.OrderItem, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		line := models.CartLine{ProductID: item.ProductID, Quantity: item.Quantity}
+		// Products that left the catalog stay in the cart until the customer removes them
+		if product, ok := products[item.ProductID]; ok {
+			product, err := currency.Product(product)
+			if err != nil {
+				return nil, err
+			}
+			line.ProductName = product.Name
+			line.Price = product.Price
+			line.LineTotal = product.Price.Mul(item.Quantity)
+			line.Available = product.CanOrder(item.Quantity)
+		}
+		if line.Available {
+			view.Subtotal += line.LineTotal
+			available = append(available, models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+		}
+		view.Items = append(view.Items, line)
+	}
+
+	if cart.CouponCode != "" {
+		quote, err := s.promoCodes.ValidatePromo(cart.CouponCode, available, currency.Currency)
+		if err != nil {
+			return nil, err
+		}
+		view.Coupon = quote
+		if quote.Valid {
+			view.Discount = quote.Discount
+		}
+	}
+	view.Total = view.Subtotal - view.Discount
+	return view, nil
+}
+
+// products returns the products of the cart that are still in the catalog, by ID.
+func (s *CartService) products(cart *models.Cart) (map[int]models.Product, error) {
+	ids := make([]int, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		ids = append(ids, item.ProductID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	products, err := s.productRepo.GetProductsByIDs(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch cart products: %w", err)
+	}
+	byID := make(map[int]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+	return byID, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"order_food_online/config"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"os"
+)
+
+type CurrencyService struct {
+	rates        repository.ExchangeRateRepository
+	baseCurrency string
+}
+
+func NewCurrencyService(rates repository.ExchangeRateRepository) *CurrencyService {
+	return &CurrencyService{rates: rates, baseCurrency: config.BaseCurrency()}
+}
+
+// BaseCurrency returns the currency catalog prices are kept in.
+func (s *CurrencyService) BaseCurrency() string {
+	return s.baseCurrency
+}
+
+// Converter returns the converter into a currency, the base currency when code is empty.
+// A currency without an exchange rate gets a converter without one, which prices only the
+// products that have a native price in it.
+func (s *CurrencyService) Converter(code string) (models.CurrencyConverter, error) {
+	code = models.NormalizeCurrency(code)
+	if code == "" || code == s.baseCurrency {
+		return models.CurrencyConverter{Currency: s.baseCurrency, Rate: models.OneRate}, nil
+	}
+	if err := models.ValidateCurrency(code); err != nil {
+		return models.CurrencyConverter{}, err
+	}
+
+	rate, err := s.rates.GetRate(code)
+	if err != nil {
+		return models.CurrencyConverter{}, err
+	}
+	if rate == nil {
+		return models.CurrencyConverter{Currency: code}, nil
+	}
+	return models.CurrencyConverter{Currency: code, Rate: rate.Rate}, nil
+}
+
+func (s *CurrencyService) ListRates() (*models.ExchangeRateTable, error) {
+	rates, err := s.rates.ListRates()
+	if err != nil {
+		return nil, err
+	}
+	return &models.ExchangeRateTable{Base: s.baseCurrency, Rates: rates}, nil
+}
+
+// SetRates validates and saves the given rates, leaving other currencies untouched.
+func (s *CurrencyService) SetRates(ratesReq models.ExchangeRatesRequest) error {
+	ratesReq.Normalize()
+	if err := ratesReq.Validate(); err != nil {
+		return err
+	}
+	if _, ok := ratesReq.Rates[s.baseCurrency]; ok {
+		return fmt.Errorf("%w: %s is the base currency", models.ErrInvalidCurrency, s.baseCurrency)
+	}
+	return s.rates.SetRates(ratesReq.Rates)
+}
+
+func (s *CurrencyService) DeleteRate(code string) error {
+	return s.rates.DeleteRate(models.NormalizeCurrency(code))
+}
+
+// LoadRatesFile saves the rates of a local JSON file, in the format accepted by SetRates.
+func (s *CurrencyService) LoadRatesFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+	var ratesReq models.ExchangeRatesRequest
+	if err := json.Unmarshal(data, &ratesReq); err != nil {
+		return fmt.Errorf("failed to parse exchange rates %s: %w", path, err)
+	}
+	return s.SetRates(ratesReq)
+}
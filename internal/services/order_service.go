@@ -1,30 +1,94 @@
 package services
 
 import (
+	"errors"
+	"order_food_online/config"
 	"order_food_online/internal/models"
 	"order_food_online/internal/repository"
+	"strings"
+	"time"
 )
 
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// maxCancellationReasonLength bounds the free text customers give when cancelling
+const maxCancellationReasonLength = 500
+
 type OrderService struct {
-	orderRepo repository.OrderRepository
+	orderRepo          repository.OrderRepository
+	currencies         *CurrencyService
+	cancellationWindow time.Duration
 }
 
-func NewOrderService(repo repository.OrderRepository) *OrderService {
-	return &OrderService{orderRepo: repo}
+func NewOrderService(repo repository.OrderRepository, currencies *CurrencyService) *OrderService {
+	return &OrderService{orderRepo: repo, currencies: currencies, cancellationWindow: config.CancellationWindow()}
 }
 
-func (s *OrderService) GetAllOrders() ([]models.Order, error) {
-	return s.orderRepo.GetAllOrders()
+func (s *OrderService) ListOrders(query models.OrderQuery) (*models.OrderPage, error) {
+	return s.orderRepo.ListOrders(query)
 }
 
 func (s *OrderService) GetOrderByID(id int) (*models.Order, error) {
 	return s.orderRepo.GetOrderByID(id)
 }
 
+// PlaceOrder places a new order in the requested currency, the base currency by default.
+// Lines ordering the same product are merged. When a concurrent request with the same
+// idempotency key wins the race, the order it placed is returned instead.
 func (s *OrderService) PlaceOrder(orderReq models.OrderRequest) (*models.Order, error) {
-	return s.orderRepo.PlaceOrder(orderReq)
+	currency, err := s.currencies.Converter(orderReq.Currency)
+	if err != nil {
+		return nil, err
+	}
+	orderReq.Currency = currency.Currency
+	orderReq.MergeItems()
+
+	order, err := s.orderRepo.PlaceOrder(orderReq, currency)
+	if errors.Is(err, repository.ErrDuplicateIdempotencyKey) {
+		return s.ReplayOrder(orderReq)
+	}
+	return order, err
+}
+
+// ReplayOrder returns the order previously placed with the request's idempotency key,
+// or nil when there is none. Reusing a key for a different request is an error.
+func (s *OrderService) ReplayOrder(orderReq models.OrderRequest) (*models.Order, error) {
+	if orderReq.IdempotencyKey == "" {
+		return nil, nil
+	}
+	if orderReq.Currency == "" {
+		orderReq.Currency = s.currencies.BaseCurrency()
+	}
+	orderReq.MergeItems()
+
+	record, err := s.orderRepo.FindIdempotencyRecord(orderReq.IdempotencyKey)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	if record.RequestHash != orderReq.Fingerprint() {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return s.orderRepo.GetOrderByID(record.OrderID)
+}
+
+// UpdateOrderStatus moves an order to a new status if the order lifecycle allows it.
+func (s *OrderService) UpdateOrderStatus(id int, statusReq models.OrderStatusRequest, changedBy string) (*models.Order, error) {
+	if !statusReq.Status.IsValid() {
+		return nil, models.ErrInvalidOrderStatus
+	}
+	return s.orderRepo.UpdateOrderStatus(id, statusReq, changedBy)
+}
+
+func (s *OrderService) GetOrderStatusHistory(id int) ([]models.OrderStatusChange, error) {
+	return s.orderRepo.GetOrderStatusHistory(id)
 }
 
-func (s *OrderService) CheckProductExists(productID int) (bool, error) {
-	return s.orderRepo.CheckProductExists(productID)
+// CancelOrder cancels an order on behalf of its customer, if it is not too late to do so.
+func (s *OrderService) CancelOrder(id int, cancelReq models.CancelOrderRequest, changedBy string) (*models.Order, error) {
+	cancelReq.Reason = strings.TrimSpace(cancelReq.Reason)
+	if reason := []rune(cancelReq.Reason); len(reason) > maxCancellationReasonLength {
+		cancelReq.Reason = string(reason[:maxCancellationReasonLength])
+	}
+	return s.orderRepo.CancelOrder(id, cancelReq, changedBy, s.cancellationWindow)
 }
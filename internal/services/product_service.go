@@ -7,16 +7,76 @@ import (
 
 type ProductService struct {
 	productRepo repository.ProductRepository
+	currencies  *CurrencyService
 }
 
-func NewProductService(repo repository.ProductRepository) *ProductService {
-	return &ProductService{productRepo: repo}
+func NewProductService(repo repository.ProductRepository, currencies *CurrencyService) *ProductService {
+	return &ProductService{productRepo: repo, currencies: currencies}
 }
 
-func (s *ProductService) GetAllProducts() ([]models.Product, error) {
-	return s.productRepo.GetAllProducts()
+// ListProducts returns a page of products priced in the query's currency.
+// Price filters and sorting by price apply to the prices in that currency.
+func (s *ProductService) ListProducts(query models.ProductQuery) (*models.ProductPage, error) {
+	currency, err := s.currencies.Converter(query.Currency)
+	if err != nil {
+		return nil, err
+	}
+	sortsByPrice := query.Sort == models.ProductSortPrice || query.Sort == models.ProductSortPriceDesc
+	if query.MinPrice.Valid || query.MaxPrice.Valid || sortsByPrice {
+		query.PriceCurrency, query.PriceRate = currency.Currency, currency.Rate
+	}
+	query.Currency = ""
+
+	page, err := s.productRepo.ListProducts(query)
+	if err != nil {
+		return nil, err
+	}
+
+	localPage := *page
+	localPage.Items = make([]models.Product, len(page.Items))
+	for i, product := range page.Items {
+		if localPage.Items[i], err = currency.Product(product); err != nil {
+			return nil, err
+		}
+	}
+	return &localPage, nil
+}
+
+// GetProductByID returns a product priced in the given currency.
+func (s *ProductService) GetProductByID(id int, currencyCode string) (*models.Product, error) {
+	currency, err := s.currencies.Converter(currencyCode)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := s.productRepo.GetProductByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	localProduct, err := currency.Product(*product)
+	if err != nil {
+		return nil, err
+	}
+	return &localProduct, nil
+}
+
+func (s *ProductService) CreateProduct(productReq models.ProductRequest) (*models.Product, error) {
+	return s.productRepo.CreateProduct(productReq)
+}
+
+func (s *ProductService) UpdateProduct(id int, productReq models.ProductRequest) (*models.Product, error) {
+	return s.productRepo.UpdateProduct(id, productReq)
+}
+
+func (s *ProductService) SetStock(id int, stockReq models.StockRequest) (*models.Product, error) {
+	return s.productRepo.SetStock(id, stockReq)
+}
+
+func (s *ProductService) DeleteProduct(id int) error {
+	return s.productRepo.DeleteProduct(id)
 }
 
-func (s *ProductService) GetProductByID(id int) (*models.Product, error) {
-	return s.productRepo.GetProductByID(id)
+func (s *ProductService) ImportProducts(productReqs []models.ProductRequest) ([]models.Product, error) {
+	return s.productRepo.ImportProducts(productReqs)
 }
@@ -1,81 +1,200 @@
 package services
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"order_food_online/internal/cache"
 	"order_food_online/internal/models"
-	"os"
-	"strings"
+	"order_food_online/internal/repository"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
+// couponReloadDelay lets a batch of file writes settle before the index is rebuilt
+const couponReloadDelay = 2 * time.Second
+
+// ErrProductNotFound is returned when a cart references an unknown product
+var ErrProductNotFound = errors.New("product not found")
+
 type PromoCodeService struct {
-	cache cache.PromoCodeCache
+	cache       cache.PromoCodeCache
+	coupons     repository.CouponRepository
+	promoCodes  repository.PromoCodeRepository
+	productRepo repository.ProductRepository
+	currencies  *CurrencyService
+	logger      *slog.Logger
 }
 
-func NewPromoCodeService(cache cache.PromoCodeCache) *PromoCodeService {
-	return &PromoCodeService{cache: cache}
+func NewPromoCodeService(
+	cache cache.PromoCodeCache,
+	coupons repository.CouponRepository,
+	promoCodes repository.PromoCodeRepository,
+	productRepo repository.ProductRepository,
+	currencies *CurrencyService,
+	logger *slog.Logger,
+) *PromoCodeService {
+	return &PromoCodeService{
+		cache:       cache,
+		coupons:     coupons,
+		promoCodes:  promoCodes,
+		productRepo: productRepo,
+		currencies:  currencies,
+		logger:      logger,
+	}
 }
 
-func (s *PromoCodeService) ValidatePromo(code string) (bool, error) {
+// ValidatePromo checks a coupon against a cart priced in the given currency and computes the
+// discount it would get. When the coupon does not apply, the returned quote carries the reason why.
+func (s *PromoCodeService) ValidatePromo(code string, items []models.OrderItem, currencyCode string) (*models.CouponQuote, error) {
+	currency, err := s.currencies.Converter(currencyCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Price the cart at current product prices
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ProductID)
+	}
+	products := make(map[int]models.Product, len(items))
+	if len(ids) > 0 {
+		found, err := s.productRepo.GetProductsByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range found {
+			products[product.ID] = product
+		}
+	}
+	priced := make([]models.OrderItem, 0, len(items))
+	categories := make(map[int]string, len(items))
+	for _, item := range items {
+		product, ok := products[item.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrProductNotFound, item.ProductID)
+		}
+		product, err := currency.Product(product)
+		if err != nil {
+			return nil, err
+		}
+		item.Price = product.Price
+		priced = append(priced, item)
+		categories[item.ProductID] = product.Category
+	}
+
+	quote := &models.CouponQuote{Code: code, Subtotal: models.Subtotal(priced), Currency: currency.Currency}
+	quote.FinalPrice = quote.Subtotal
+
 	// Validate code length
 	if len(code) < 8 || len(code) > 10 {
-		return false, nil
+		quote.Reason = models.CouponReasonInvalidFormat
+		return quote, nil
 	}
 
+	if !s.isKnownCode(code) {
+		quote.Reason = models.CouponReasonUnknownCode
+		return quote, nil
+	}
+
+	// Check the restrictions and discount rule, if the code carries one
+	promo, err := s.promoCodes.GetPromoCode(code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discount for coupon %s: %w", code, err)
+	}
+	if promo != nil {
+		localPromo, err := currency.PromoCode(*promo)
+		if err != nil {
+			return nil, err
+		}
+		if reason := localPromo.Check(priced, categories, time.Now()); reason != "" {
+			quote.Reason = reason
+			return quote, nil
+		}
+		quote.Discount = localPromo.Discount(priced, categories)
+		quote.FinalPrice = quote.Subtotal - quote.Discount
+	}
+
+	quote.Valid = true
+	return quote, nil
+}
+
+// isKnownCode reports whether code is listed in the coupon bases.
+func (s *PromoCodeService) isKnownCode(code string) bool {
 	// Check cache for the promo code
 	cachedPromo, err := s.cache.GetPromoCode(code)
 	if err == nil && cachedPromo != nil {
-		return cachedPromo.IsValid, nil
+		return cachedPromo.IsValid
 	}
 
-	// Validate against files
-	isValid, err := validatePromoCodeFromFiles(code)
-	if err != nil {
-		return false, err
-	}
+	// Validate against the coupon bases index
+	isValid := s.coupons.IsValid(code)
 
 	// Cache the result
 	ttl := 24 * time.Hour // Cache the result for 1 day
 	_ = s.cache.SetPromoCode(code, &models.PromoCode{Code: code, IsValid: isValid}, ttl)
 
-	return isValid, nil
+	return isValid
 }
 
-func validatePromoCodeFromFiles(code string) (bool, error) {
-	files := []string{"couponbase1.txt", "couponbase2.txt", "couponbase3.txt"}
-	matchCount := 0
+// CouponStatus reports the coupon base files and number of codes currently loaded.
+func (s *PromoCodeService) CouponStatus() models.CouponStatus {
+	return s.coupons.Status()
+}
 
-	// Check each file for the promo code
-	for _, file := range files {
-		found, err := searchInFile(fmt.Sprintf("%s/%s", os.Getenv("COUPON_DIR"), file), code)
-		if err != nil {
-			return false, err
-		}
-		if found {
-			matchCount++
-		}
-		if matchCount >= 2 {
-			return true, nil
-		}
+// ReloadCoupons rebuilds the coupon index and drops cached results of codes whose validity changed.
+func (s *PromoCodeService) ReloadCoupons() error {
+	changed, err := s.coupons.Reload()
+	if err != nil {
+		return fmt.Errorf("failed to reload coupon bases: %w", err)
+	}
+	if err := s.cache.DeletePromoCodes(changed); err != nil {
+		return fmt.Errorf("failed to invalidate %d cached promo codes: %w", len(changed), err)
 	}
 
-	return false, nil
+	s.logger.Info("Coupon bases reloaded", slog.Int("codes", s.coupons.Len()), slog.Int("changed", len(changed)))
+	return nil
 }
 
-func searchInFile(filePath, code string) (bool, error) {
-	file, err := os.Open(filePath)
+// WatchCoupons reloads the coupon index whenever a coupon base file changes, until ctx is done.
+func (s *PromoCodeService) WatchCoupons(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return false, err
+		return err
 	}
-	defer file.Close()
+	defer watcher.Close()
+
+	if err := watcher.Add(s.coupons.Dir()); err != nil {
+		return fmt.Errorf("failed to watch coupon directory %s: %w", s.coupons.Dir(), err)
+	}
+
+	// Debounce bursts of events, e.g. a large file being copied in
+	timer := time.NewTimer(couponReloadDelay)
+	timer.Stop()
+	defer timer.Stop()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		if strings.TrimSpace(scanner.Text()) == code {
-			return true, nil
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if repository.IsCouponBaseFile(event.Name) && event.Op != fsnotify.Chmod {
+				timer.Reset(couponReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			s.logger.Error("Coupon directory watcher failed", "error", err)
+		case <-timer.C:
+			if err := s.ReloadCoupons(); err != nil {
+				s.logger.Error("Failed to reload coupon bases", "error", err)
+			}
 		}
 	}
-	return false, scanner.Err()
 }
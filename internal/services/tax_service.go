@@ -0,0 +1,31 @@
+package services
+
+import (
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+)
+
+type TaxService struct {
+	taxRules repository.TaxRuleRepository
+}
+
+func NewTaxService(taxRules repository.TaxRuleRepository) *TaxService {
+	return &TaxService{taxRules: taxRules}
+}
+
+func (s *TaxService) ListRules() ([]models.TaxRule, error) {
+	return s.taxRules.ListRules()
+}
+
+// SetRule validates and saves the tax rule of a category. It applies to orders placed afterwards.
+func (s *TaxService) SetRule(rule models.TaxRule) (*models.TaxRule, error) {
+	rule.Category = models.NormalizeTaxCategory(rule.Category)
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return s.taxRules.SetRule(rule)
+}
+
+func (s *TaxService) DeleteRule(category string) error {
+	return s.taxRules.DeleteRule(models.NormalizeTaxCategory(category))
+}
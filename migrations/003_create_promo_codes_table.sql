@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS promo_codes
+(
+    code            VARCHAR(10) PRIMARY KEY,
+    discount_type   VARCHAR(20)    NOT NULL CHECK (discount_type IN ('percentage', 'fixed', 'free_item')),
+    discount_value  NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    free_product_id INT REFERENCES products (id),
+    max_discount    NUMERIC(10, 2),
+    created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS subtotal NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS discount NUMERIC(10, 2) NOT NULL DEFAULT 0;
@@ -0,0 +1,17 @@
+ALTER TABLE promo_codes
+    ADD COLUMN IF NOT EXISTS max_redemptions              INT,
+    ADD COLUMN IF NOT EXISTS max_redemptions_per_customer INT,
+    ADD COLUMN IF NOT EXISTS single_use                   BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS coupon_redemptions
+(
+    id          SERIAL PRIMARY KEY,
+    code        VARCHAR(10) NOT NULL,
+    order_id    INT         NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    customer_id INT,
+    redeemed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS coupon_redemptions_order_id_idx ON coupon_redemptions (order_id);
+CREATE INDEX IF NOT EXISTS coupon_redemptions_active_code_idx ON coupon_redemptions (code, customer_id) WHERE released_at IS NULL;
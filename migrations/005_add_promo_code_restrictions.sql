@@ -0,0 +1,6 @@
+ALTER TABLE promo_codes
+    ADD COLUMN IF NOT EXISTS starts_at           TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS ends_at             TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS min_order_value     NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS allowed_categories  VARCHAR(50)[]  NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS allowed_product_ids INT[]          NOT NULL DEFAULT '{}';
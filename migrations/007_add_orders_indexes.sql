@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS orders_created_at_idx ON orders (created_at, id);
+CREATE INDEX IF NOT EXISTS orders_coupon_code_idx ON orders (coupon_code, id) WHERE coupon_code IS NOT NULL;
@@ -0,0 +1,10 @@
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS product_name VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE order_items
+SET product_name = products.name
+FROM products
+WHERE products.id = order_items.product_id
+  AND order_items.product_name = '';
+
+CREATE INDEX IF NOT EXISTS order_items_order_id_idx ON order_items (order_id);
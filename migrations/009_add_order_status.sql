@@ -0,0 +1,18 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'confirmed', 'preparing', 'ready', 'out_for_delivery', 'delivered', 'cancelled', 'refunded'));
+
+CREATE INDEX IF NOT EXISTS orders_status_idx ON orders (status, id);
+
+CREATE TABLE IF NOT EXISTS order_status_history
+(
+    id          SERIAL PRIMARY KEY,
+    order_id    INT          NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    from_status VARCHAR(20)  NOT NULL,
+    to_status   VARCHAR(20)  NOT NULL,
+    changed_by  VARCHAR(255) NOT NULL,
+    note        TEXT         NOT NULL DEFAULT '',
+    changed_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_id_idx ON order_status_history (order_id, id);
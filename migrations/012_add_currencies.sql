@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS exchange_rates
+(
+    currency   CHAR(3) PRIMARY KEY,
+    rate       NUMERIC(18, 6) NOT NULL CHECK (rate > 0),
+    updated_at TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS product_prices
+(
+    product_id INT            NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    currency   CHAR(3)        NOT NULL,
+    price      NUMERIC(10, 2) NOT NULL CHECK (price > 0),
+    PRIMARY KEY (product_id, currency)
+);
+
+-- Existing orders were placed in the base currency
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+CREATE INDEX IF NOT EXISTS orders_currency_idx ON orders (currency, id);
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS tax_rules
+(
+    category   VARCHAR(50) PRIMARY KEY, -- a product category, or * for every other category
+    rate       NUMERIC(5, 2) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    inclusive  BOOLEAN       NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS discount      NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_rate      NUMERIC(5, 2)  NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN        NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS net_amount    NUMERIC(10, 2),
+    ADD COLUMN IF NOT EXISTS tax_amount    NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS gross_amount  NUMERIC(10, 2);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS net_total NUMERIC(10, 2),
+    ADD COLUMN IF NOT EXISTS tax_total NUMERIC(10, 2) NOT NULL DEFAULT 0;
+
+-- Orders placed before taxes were computed carry no tax
+UPDATE order_items
+SET net_amount   = price * quantity,
+    gross_amount = price * quantity
+WHERE net_amount IS NULL;
+
+UPDATE orders
+SET net_total = final_price
+WHERE net_total IS NULL;
+
+ALTER TABLE order_items
+    ALTER COLUMN net_amount SET NOT NULL,
+    ALTER COLUMN gross_amount SET NOT NULL;
+
+ALTER TABLE orders
+    ALTER COLUMN net_total SET DEFAULT 0,
+    ALTER COLUMN net_total SET NOT NULL;
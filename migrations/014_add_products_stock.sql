@@ -0,0 +1,8 @@
+-- A NULL stock means the product is not stock-tracked
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS stock        INT CHECK (stock >= 0),
+    ADD COLUMN IF NOT EXISTS is_available BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Items whose quantity was taken from stock, to be given back on cancellation
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS stock_reserved BOOLEAN NOT NULL DEFAULT FALSE;
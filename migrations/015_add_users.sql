@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    id            SERIAL PRIMARY KEY,
+    email         VARCHAR(255) NOT NULL,
+    name          VARCHAR(255) NOT NULL DEFAULT '',
+    password_hash VARCHAR(255) NOT NULL,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Emails are stored lowercased, so this also makes them unique regardless of case
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (email);
+
+-- Refresh tokens are stored hashed. Each refresh replaces the token with a new one of the
+-- same family; presenting a replaced token again revokes the whole family.
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id          SERIAL PRIMARY KEY,
+    user_id     INT       NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id   CHAR(32)  NOT NULL,
+    token_hash  CHAR(64)  NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL, -- set by the API, so it carries its time zone
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at  TIMESTAMP,
+    replaced_by INT REFERENCES refresh_tokens (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS refresh_tokens_token_hash_idx ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS customer_id INT REFERENCES users (id);
+
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id, id) WHERE customer_id IS NOT NULL;
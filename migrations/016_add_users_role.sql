@@ -0,0 +1,4 @@
+-- Accounts are customers unless an admin grants them a staff or admin role
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(30) NOT NULL DEFAULT 'customer'
+        CHECK (role IN ('customer', 'kitchen_staff', 'restaurant_admin', 'platform_admin'));
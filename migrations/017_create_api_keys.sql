@@ -0,0 +1,17 @@
+-- API keys let partners call the API server to server. Only the SHA-256 hash of a key is
+-- stored; its first characters are kept so admins can tell keys apart.
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           SERIAL PRIMARY KEY,
+    name         VARCHAR(100) NOT NULL,
+    prefix       VARCHAR(16)  NOT NULL,
+    key_hash     CHAR(64)     NOT NULL,
+    scopes       TEXT[]       NOT NULL DEFAULT '{}',
+    created_by   VARCHAR(255) NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_key_hash_idx ON api_keys (key_hash);
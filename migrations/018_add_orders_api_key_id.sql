@@ -0,0 +1,5 @@
+-- Orders placed with a partner API key belong to that key, so partners only see their own
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS api_key_id INT REFERENCES api_keys (id);
+
+CREATE INDEX IF NOT EXISTS orders_api_key_id_idx ON orders (api_key_id, id) WHERE api_key_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Store when orders were placed as an absolute time, so the cancellation window does not depend
+-- on the time zone of the database session. Existing values were written in the session time
+-- zone, which is how they are converted.
+ALTER TABLE orders
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+package auth
+
+import "errors"
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrAPIKeyExpired = errors.New("API key has expired")
+)
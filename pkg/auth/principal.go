@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject   string    `json:"subject"`
+	Name      string    `json:"name,omitempty"`
+	Roles     []string  `json:"roles"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// APIKeyID is the ID of the partner API key the principal authenticated with, 0 for
+	// bearer tokens. Tokens can't set it.
+	APIKeyID int `json:"api_key_id,omitempty"`
+}
+
+// HasRole reports whether the principal was granted the role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the principal's token carries the scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// leeway tolerates clock skew between the token issuer and the API
+const leeway = 30 * time.Second
+
+var (
+	ErrTokenExpired     = errors.New("token has expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrMissingSubject   = errors.New("token has no subject")
+	ErrMissingExpiry    = errors.New("token has no expiry")
+)
+
+// Audience is the aud claim, which tokens give either as a string or as a list.
+type Audience []string
+
+// UnmarshalJSON reads a single audience or a list of them.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Contains reports whether the token is meant for the audience.
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims are the JWT claims the API reads. Times are Unix timestamps.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+
+	Name  string   `json:"name,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	Scope string   `json:"scope,omitempty"` // space separated, as in OAuth 2.0
+}
+
+// Valid checks the token has a subject and is used within its validity period.
+func (c *Claims) Valid() error {
+	now := time.Now()
+	switch {
+	case c.Subject == "":
+		return ErrMissingSubject
+	case c.ExpiresAt == 0:
+		return ErrMissingExpiry
+	case now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)):
+		return ErrTokenExpired
+	case c.NotBefore != 0 && now.Before(time.Unix(c.NotBefore, 0).Add(-leeway)):
+		return ErrTokenNotYetValid
+	}
+	return nil
+}
+
+// Principal returns the caller the claims describe.
+func (c *Claims) Principal() *Principal {
+	return &Principal{
+		Subject:   c.Subject,
+		Name:      c.Name,
+		Roles:     c.Roles,
+		Scopes:    strings.Fields(c.Scope),
+		ExpiresAt: time.Unix(c.ExpiresAt, 0),
+	}
+}
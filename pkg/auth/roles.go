@@ -0,0 +1,88 @@
+package auth
+
+// Roles granted to principals. Customer accounts are created with RoleCustomer.
+const (
+	RoleCustomer        = "customer"
+	RoleKitchenStaff    = "kitchen_staff"
+	RoleRestaurantAdmin = "restaurant_admin"
+	RolePlatformAdmin   = "platform_admin"
+
+	// roleLegacyAdmin is the role admin tokens carried before roles were split.
+	// It grants the permissions of a platform admin.
+	roleLegacyAdmin = "admin"
+)
+
+// Roles lists the roles that can be assigned to accounts.
+var Roles = []string{RoleCustomer, RoleKitchenStaff, RoleRestaurantAdmin, RolePlatformAdmin}
+
+// IsRole reports whether role can be assigned to accounts.
+func IsRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Permission is an action routes are restricted to.
+type Permission string
+
+const (
+	// PermPlaceOrders lets a principal place orders
+	PermPlaceOrders Permission = "orders:place"
+	// PermReadAllOrders lets a principal see every order rather than only their own
+	PermReadAllOrders Permission = "orders:read_all"
+	// PermUpdateOrderStatus lets a principal move orders through their lifecycle
+	PermUpdateOrderStatus Permission = "orders:update_status"
+	// PermManageCatalog lets a principal create, edit and delete products and their stock
+	PermManageCatalog Permission = "catalog:write"
+	// PermManagePricing lets a principal edit exchange rates and tax rules
+	PermManagePricing Permission = "pricing:write"
+	// PermManageUsers lets a principal assign roles to accounts
+	PermManageUsers Permission = "users:write"
+	// PermManageAPIKeys lets a principal create, list and revoke partner API keys
+	PermManageAPIKeys Permission = "api_keys:write"
+)
+
+// Permissions lists every permission, e.g. to validate the scopes of API keys.
+var Permissions = []Permission{
+	PermPlaceOrders, PermReadAllOrders, PermUpdateOrderStatus, PermManageCatalog, PermManagePricing, PermManageUsers, PermManageAPIKeys,
+}
+
+// IsPermission reports whether permission is a known permission.
+func IsPermission(permission string) bool {
+	for _, p := range Permissions {
+		if string(p) == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// rolePermissions lists what each role may do. Customers only place orders; they see their own
+// orders without needing a permission.
+var rolePermissions = map[string][]Permission{
+	RoleCustomer:        {PermPlaceOrders},
+	RoleKitchenStaff:    {PermPlaceOrders, PermReadAllOrders, PermUpdateOrderStatus},
+	RoleRestaurantAdmin: {PermPlaceOrders, PermReadAllOrders, PermUpdateOrderStatus, PermManageCatalog},
+	RolePlatformAdmin:   Permissions,
+	roleLegacyAdmin:     Permissions,
+}
+
+// Can reports whether one of the principal's roles grants the permission. API keys have no
+// role: they are granted permissions directly as scopes. The scopes of bearer tokens grant
+// nothing, so tokens from other issuers can't claim permissions the API never assigned.
+func (p *Principal) Can(permission Permission) bool {
+	if p.APIKeyID != 0 {
+		return p.HasScope(string(permission))
+	}
+	for _, role := range p.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
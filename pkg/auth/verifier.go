@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrUnknownSigningKey  = errors.New("unknown signing key")
+	ErrInvalidIssuer      = errors.New("token was issued by an untrusted issuer")
+	ErrInvalidAudience    = errors.New("token is not meant for this API")
+	ErrReservedSubject    = errors.New("only tokens issued by the API can authenticate customer accounts")
+	ErrNoVerificationKeys = errors.New("no JWT verification key configured: set JWT_SECRET or JWT_JWKS_FILE")
+)
+
+// Config configures how bearer tokens are verified.
+type Config struct {
+	// HMACSecret verifies HS256 tokens, which are rejected when it is empty
+	HMACSecret []byte
+	// JWKSFile is a local JSON Web Key Set whose RSA keys verify RS256 tokens
+	JWKSFile string
+	// Issuer and Audience are checked against the iss and aud claims when set
+	Issuer   string
+	Audience string
+}
+
+// Verifier checks bearer tokens and extracts the principal they authenticate.
+type Verifier struct {
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	issuer     string
+	audience   string
+	parser     *jwt.Parser
+}
+
+// NewVerifier creates a Verifier, loading the RSA keys of the configured key set.
+func NewVerifier(config Config) (*Verifier, error) {
+	v := &Verifier{
+		hmacSecret: config.HMACSecret,
+		issuer:     config.Issuer,
+		audience:   config.Audience,
+	}
+	if config.JWKSFile != "" {
+		keys, err := LoadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKeys = keys
+	}
+
+	var methods []string
+	if len(v.hmacSecret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if len(v.rsaKeys) > 0 {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, ErrNoVerificationKeys
+	}
+	v.parser = &jwt.Parser{ValidMethods: methods}
+	return v, nil
+}
+
+// Verify checks the token's signature, validity period, issuer and audience, and returns
+// the principal it authenticates. Errors wrap ErrInvalidToken.
+//
+// Customer accounts are only authenticated by the HS256 tokens the API issues: tokens signed
+// by the keys of other issuers can't claim the subject of a customer account.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	var claims Claims
+	parsed, err := v.parser.ParseWithClaims(token, &claims, v.key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, validationCause(err))
+	}
+	if parsed.Method.Alg() != jwt.SigningMethodHS256.Alg() && strings.HasPrefix(claims.Subject, userSubjectPrefix) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrReservedSubject)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrInvalidIssuer)
+	}
+	if v.audience != "" && !claims.Audience.Contains(v.audience) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrInvalidAudience)
+	}
+	return claims.Principal(), nil
+}
+
+// key returns the key verifying the token's signature, chosen by its algorithm and key ID.
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.hmacSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := v.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		// Tokens may leave the key ID out when the set holds a single key
+		if kid == "" && len(v.rsaKeys) == 1 {
+			for _, key := range v.rsaKeys {
+				return key, nil
+			}
+		}
+		return nil, ErrUnknownSigningKey
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// validationCause returns the reason jwt gives for rejecting a token.
+func validationCause(err error) error {
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Inner != nil {
+		return validationErr.Inner
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"order_food_online/pkg/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiKeyHeader carries the API key of partner integrations
+const apiKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator checks partner API keys and returns the principal they authenticate.
+// Unknown and revoked keys fail with auth.ErrInvalidAPIKey, expired ones with auth.ErrAPIKeyExpired.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(key string) (*auth.Principal, error)
+}
+
+// APIKeyMiddleware authenticates requests carrying an API key in the X-API-Key header, as an
+// alternative to bearer tokens. It must run before AuthMiddleware, which lets authenticated
+// requests through. Requests may not carry both an API key and a bearer token.
+func APIKeyMiddleware(apiKeys APIKeyAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(apiKeyHeader)
+			if key == "" {
+				return next(c)
+			}
+			if c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "send either an API key or a bearer token, not both")
+			}
+
+			principal, err := apiKeys.AuthenticateAPIKey(key)
+			switch {
+			case errors.Is(err, auth.ErrAPIKeyExpired):
+				return echo.NewHTTPError(http.StatusUnauthorized, "API key has expired")
+			case errors.Is(err, auth.ErrInvalidAPIKey):
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid API key")
+			case err != nil:
+				return err
+			}
+
+			SetPrincipal(c, principal)
+			return next(c)
+		}
+	}
+}
@@ -1,22 +1,164 @@
 package middleware
 
 import (
-	"github.com/labstack/echo/v4"
+	"errors"
+	"fmt"
 	"net/http"
+	"order_food_online/pkg/auth"
+	"strings"
+
+	"github.com/labstack/echo/v4"
 )
 
-// AuthMiddleware is a demo middleware function that checks for the presence of an Authorization header
-func AuthMiddleware() echo.MiddlewareFunc {
+// principalKey is the context key holding the principal authenticated by AuthMiddleware
+const principalKey = "principal"
+
+// authRealm names the protection space in WWW-Authenticate challenges
+const authRealm = "order_food_online"
+
+// Principal returns the caller authenticated by AuthMiddleware, or nil for anonymous requests.
+func Principal(c echo.Context) *auth.Principal {
+	principal, _ := c.Get(principalKey).(*auth.Principal)
+	return principal
+}
+
+// SetPrincipal stores the authenticated caller in the context.
+func SetPrincipal(c echo.Context, principal *auth.Principal) {
+	c.Set(principalKey, principal)
+}
+
+// Actor returns who made the request, for audit logs: the principal's subject, or "anonymous".
+func Actor(c echo.Context) string {
+	if principal := Principal(c); principal != nil {
+		return principal.Subject
+	}
+	return "anonymous"
+}
+
+// AuthMiddleware verifies the bearer token of every request and stores the principal it
+// authenticates in the context. Requests without a token only reach public routes, unless an
+// earlier middleware such as APIKeyMiddleware authenticated them; a token that fails
+// verification is rejected on every route.
+// Public routes are route patterns, either "/health" for every method or "GET /products/:id".
+func AuthMiddleware(verifier *auth.Verifier, publicRoutes []string) echo.MiddlewareFunc {
+	public := newRouteSet(publicRoutes)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			if header == "" {
+				if Principal(c) != nil || public.matches(c) {
+					return next(c)
+				}
+				return unauthorized(c, "", "missing bearer token")
+			}
+
+			scheme, token, _ := strings.Cut(header, " ")
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				return unauthorized(c, "invalid_request", "authorization header must be a bearer token")
+			}
+			principal, err := verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				c.Logger().Debugf("Rejected bearer token: %v", err)
+				return unauthorized(c, "invalid_token", tokenErrorDescription(err))
+			}
+
+			SetPrincipal(c, principal)
+			return next(c)
+		}
+	}
+}
+
+// RequireRole restricts a route to principals holding one of the roles. Anonymous callers
+// get 401, authenticated callers without the role 403.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := Principal(c)
+			if principal == nil {
+				return unauthorized(c, "", "authentication required")
+			}
+			for _, role := range roles {
+				if principal.HasRole(role) {
+					return next(c)
+				}
+			}
+			return forbidden(c, "insufficient_scope", "this route requires one of the roles "+strings.Join(roles, ", "))
+		}
+	}
+}
+
+// RequirePermission restricts a route to principals whose roles grant the permission.
+// Anonymous callers get 401, authenticated callers without the permission 403.
+func RequirePermission(permission auth.Permission) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			token := c.Request().Header.Get("Authorization")
-			if token == "" {
-				return c.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Unauthorized",
-				})
+			principal := Principal(c)
+			if principal == nil {
+				return unauthorized(c, "", "authentication required")
+			}
+			if !principal.Can(permission) {
+				return forbidden(c, "insufficient_scope", fmt.Sprintf("this route requires the %s permission", permission))
 			}
-			// actual logic here (not implemented)
 			return next(c)
 		}
 	}
 }
+
+// unauthorized rejects a request lacking valid credentials, with the challenge RFC 6750 asks for.
+// errorCode is left empty when the request carried no credentials at all.
+func unauthorized(c echo.Context, errorCode, description string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, bearerChallenge(errorCode, description))
+	return echo.NewHTTPError(http.StatusUnauthorized, description)
+}
+
+// forbidden rejects an authenticated request the caller is not allowed to make.
+func forbidden(c echo.Context, errorCode, description string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, bearerChallenge(errorCode, description))
+	return echo.NewHTTPError(http.StatusForbidden, description)
+}
+
+func bearerChallenge(errorCode, description string) string {
+	challenge := fmt.Sprintf("Bearer realm=%q", authRealm)
+	if errorCode != "" {
+		challenge += fmt.Sprintf(", error=%q, error_description=%q", errorCode, description)
+	}
+	return challenge
+}
+
+// tokenErrorDescription tells clients why their token was rejected, without detailing
+// signature or key problems.
+func tokenErrorDescription(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		return "token has expired"
+	case errors.Is(err, auth.ErrTokenNotYetValid):
+		return "token is not valid yet"
+	}
+	return "invalid bearer token"
+}
+
+// routeSet matches requests against route patterns.
+type routeSet map[string]bool
+
+// anyMethod matches routes listed without a method
+const anyMethod = "*"
+
+func newRouteSet(routes []string) routeSet {
+	set := routeSet{}
+	for _, route := range routes {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		method, path, ok := strings.Cut(route, " ")
+		if !ok {
+			method, path = anyMethod, route
+		}
+		set[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = true
+	}
+	return set
+}
+
+func (s routeSet) matches(c echo.Context) bool {
+	return s[anyMethod+" "+c.Path()] || s[c.Request().Method+" "+c.Path()]
+}
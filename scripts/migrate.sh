@@ -4,4 +4,21 @@ set -e
 echo "Running migrations..."
 psql $DATABASE_URL -f migrations/001_create_products_table.sql
 psql $DATABASE_URL -f migrations/002_create_orders_table.sql
+psql $DATABASE_URL -f migrations/003_create_promo_codes_table.sql
+psql $DATABASE_URL -f migrations/004_create_coupon_redemptions_table.sql
+psql $DATABASE_URL -f migrations/005_add_promo_code_restrictions.sql
+psql $DATABASE_URL -f migrations/006_add_products_deleted_at.sql
+psql $DATABASE_URL -f migrations/007_add_orders_indexes.sql
+psql $DATABASE_URL -f migrations/008_add_order_items_product_name.sql
+psql $DATABASE_URL -f migrations/009_add_order_status.sql
+psql $DATABASE_URL -f migrations/010_add_orders_cancellation_reason.sql
+psql $DATABASE_URL -f migrations/011_add_orders_idempotency_key.sql
+psql $DATABASE_URL -f migrations/012_add_currencies.sql
+psql $DATABASE_URL -f migrations/013_add_taxes.sql
+psql $DATABASE_URL -f migrations/014_add_products_stock.sql
+psql $DATABASE_URL -f migrations/015_add_users.sql
+psql $DATABASE_URL -f migrations/016_add_users_role.sql
+psql $DATABASE_URL -f migrations/017_create_api_keys.sql
+psql $DATABASE_URL -f migrations/018_add_orders_api_key_id.sql
+psql $DATABASE_URL -f migrations/019_orders_created_at_timestamptz.sql
 echo "Migrations completed."
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestIssuer returns an issuer whose tokens the test verifier accepts.
+func newTestIssuer(t testing.TB) (*auth.TokenIssuer, *auth.Verifier) {
+	issuer, err := auth.NewTokenIssuer(auth.Config{HMACSecret: testJWTSecret, Issuer: "order_food_online"}, 15*time.Minute)
+	require.NoError(t, err)
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: testJWTSecret, Issuer: "order_food_online"})
+	require.NoError(t, err)
+	return issuer, verifier
+}
+
+// newAuthHandler returns an AuthHandler backed by the given mocks.
+func newAuthHandler(t testing.TB, users *mocks.MockUserRepository, tokens *mocks.MockRefreshTokenRepository) *handlers.AuthHandler {
+	issuer, _ := newTestIssuer(t)
+	return handlers.NewAuthHandler(services.NewAuthService(users, tokens, issuer, slog.Default()), slog.Default())
+}
+
+func postJSON(path, body string) (*http.Request, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	return req, httptest.NewRecorder()
+}
+
+func TestRegisterHandler(t *testing.T) {
+	users := new(mocks.MockUserRepository)
+	users.On("CreateUser", mock.MatchedBy(func(user models.User) bool {
+		return user.Email == "ada@example.com" && user.Name == "Ada" && user.Role == auth.RoleCustomer &&
+			bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("correct horse")) == nil
+	})).Return(&models.User{ID: 7, Email: "ada@example.com", Name: "Ada", PasswordHash: "hash"}, nil)
+	handler := newAuthHandler(t, users, new(mocks.MockRefreshTokenRepository))
+
+	req, rec := postJSON("/auth/register", `{"email":" Ada@Example.com ","password":"correct horse","name":"Ada"}`)
+	serve(echo.New().NewContext(req, rec), handler.Register)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"id":7`)
+	assert.NotContains(t, rec.Body.String(), "hash")
+	users.AssertExpectations(t)
+}
+
+func TestRegisterHandler_Invalid(t *testing.T) {
+	users := new(mocks.MockUserRepository)
+	handler := newAuthHandler(t, users, new(mocks.MockRefreshTokenRepository))
+
+	req, rec := postJSON("/auth/register", `{"email":"not an email","password":"short"}`)
+	serve(echo.New().NewContext(req, rec), handler.Register)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	body := decodeError(t, rec)
+	assert.Equal(t, handlers.CodeValidationFailed, body.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "password", Message: "must be between 8 and 72 bytes long"},
+	}, body.Details)
+	users.AssertNotCalled(t, "CreateUser", mock.Anything)
+}
+
+func TestRegisterHandler_EmailTaken(t *testing.T) {
+	users := new(mocks.MockUserRepository)
+	users.On("CreateUser", mock.Anything).Return(nil, repository.ErrDuplicateEmail)
+	handler := newAuthHandler(t, users, new(mocks.MockRefreshTokenRepository))
+
+	req, rec := postJSON("/auth/register", `{"email":"ada@example.com","password":"correct horse"}`)
+	serve(echo.New().NewContext(req, rec), handler.Register)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, handlers.CodeConflict, decodeError(t, rec).Code)
+}
+
+func TestLoginHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users := new(mocks.MockUserRepository)
+	users.On("GetUserByEmail", "ada@example.com").Return(&models.User{ID: 7, Email: "ada@example.com", Name: "Ada", Role: auth.RoleCustomer, PasswordHash: string(hash)}, nil)
+	users.On("GetUserByEmail", "bob@example.com").Return(nil, sql.ErrNoRows)
+	tokens := new(mocks.MockRefreshTokenRepository)
+	tokens.On("CreateRefreshToken", mock.MatchedBy(func(token models.RefreshToken) bool {
+		return token.UserID == 7 && len(token.TokenHash) == 64 && len(token.FamilyID) == 32 && token.ExpiresAt.After(time.Now())
+	})).Return(nil).Once()
+	handler := newAuthHandler(t, users, tokens)
+
+	req, rec := postJSON("/auth/login", `{"email":"ADA@example.com","password":"correct horse"}`)
+	serve(echo.New().NewContext(req, rec), handler.Login)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var pair models.TokenPair
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 900, pair.ExpiresIn)
+	assert.NotEmpty(t, pair.RefreshToken)
+
+	// The access token is accepted by the middleware's verifier
+	_, verifier := newTestIssuer(t)
+	principal, err := verifier.Verify(pair.AccessToken)
+	require.NoError(t, err)
+	userID, ok := principal.UserID()
+	assert.True(t, ok)
+	assert.Equal(t, 7, userID)
+	assert.Equal(t, []string{auth.RoleCustomer}, principal.Roles)
+
+	for _, body := range []string{
+		`{"email":"ada@example.com","password":"wrong password"}`,
+		`{"email":"bob@example.com","password":"correct horse"}`,
+	} {
+		req, rec := postJSON("/auth/login", body)
+		serve(echo.New().NewContext(req, rec), handler.Login)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "invalid email or password", decodeError(t, rec).Message)
+	}
+	tokens.AssertExpectations(t)
+}
+
+func TestLoginHandler_BootstrapAdmin(t *testing.T) {
+	t.Setenv("BOOTSTRAP_ADMIN_EMAIL", " Root@Example.com ")
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, verifier := newTestIssuer(t)
+
+	for _, tt := range []struct {
+		name    string
+		email   string
+		granted bool // whether there was no platform admin yet
+		role    string
+	}{
+		{"first admin", "root@example.com", true, auth.RolePlatformAdmin},
+		{"admin exists", "root@example.com", false, auth.RoleCustomer},
+		{"other account", "ada@example.com", false, auth.RoleCustomer},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			users := new(mocks.MockUserRepository)
+			users.On("GetUserByEmail", tt.email).Return(&models.User{ID: 1, Email: tt.email, Role: auth.RoleCustomer, PasswordHash: string(hash)}, nil)
+			if tt.email == "root@example.com" {
+				users.On("GrantFirstRole", 1, auth.RolePlatformAdmin).Return(tt.granted, nil).Once()
+			}
+			tokens := new(mocks.MockRefreshTokenRepository)
+			tokens.On("CreateRefreshToken", mock.Anything).Return(nil)
+			handler := newAuthHandler(t, users, tokens)
+
+			req, rec := postJSON("/auth/login", `{"email":"`+tt.email+`","password":"correct horse"}`)
+			serve(echo.New().NewContext(req, rec), handler.Login)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var pair models.TokenPair
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+			principal, err := verifier.Verify(pair.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, []string{tt.role}, principal.Roles)
+			users.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRefreshHandler_Rotation(t *testing.T) {
+	users := new(mocks.MockUserRepository)
+	users.On("GetUserByID", 7).Return(&models.User{ID: 7, Name: "Ada"}, nil)
+	tokens := new(mocks.MockRefreshTokenRepository)
+	var next models.RefreshToken
+	tokens.On("RotateRefreshToken", mock.AnythingOfType("string"), mock.AnythingOfType("models.RefreshToken")).
+		Run(func(args mock.Arguments) { next = args.Get(1).(models.RefreshToken) }).
+		Return(&models.RefreshToken{ID: 2, UserID: 7, FamilyID: "family"}, nil).Once()
+	tokens.On("RotateRefreshToken", mock.Anything, mock.Anything).Return(nil, repository.ErrRefreshTokenReused).Once()
+	handler := newAuthHandler(t, users, tokens)
+
+	req, rec := postJSON("/auth/refresh", `{"refresh_token":"first"}`)
+	serve(echo.New().NewContext(req, rec), handler.Refresh)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var pair models.TokenPair
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+	assert.NotEqual(t, "first", pair.RefreshToken)
+	assert.NotEqual(t, pair.RefreshToken, next.TokenHash, "only the hash of the token is stored")
+	assert.Len(t, next.TokenHash, 64)
+
+	// Presenting a rotated token again is rejected
+	req, rec = postJSON("/auth/refresh", `{"refresh_token":"first"}`)
+	serve(echo.New().NewContext(req, rec), handler.Refresh)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, handlers.CodeUnauthorized, decodeError(t, rec).Code)
+	tokens.AssertExpectations(t)
+}
+
+func TestLogoutHandler(t *testing.T) {
+	tokens := new(mocks.MockRefreshTokenRepository)
+	tokens.On("RevokeRefreshTokenFamily", mock.MatchedBy(func(hash string) bool { return len(hash) == 64 })).Return(nil)
+	handler := newAuthHandler(t, new(mocks.MockUserRepository), tokens)
+
+	req, rec := postJSON("/auth/logout", `{"refresh_token":"token"}`)
+	serve(echo.New().NewContext(req, rec), handler.Logout)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	req, rec = postJSON("/auth/logout", `{}`)
+	serve(echo.New().NewContext(req, rec), handler.Logout)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	tokens.AssertNumberOfCalls(t, "RevokeRefreshTokenFamily", 1)
+}
+
+func TestPlaceOrderHandler_RecordsCustomer(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("PlaceOrder", mock.MatchedBy(func(req models.OrderRequest) bool {
+		return req.CustomerID.Int64 == 7
+	}), mock.Anything).Return(&models.Order{ID: 1}, nil).Once()
+	mockRepo.On("PlaceOrder", mock.MatchedBy(func(req models.OrderRequest) bool {
+		return !req.CustomerID.Valid
+	}), mock.Anything).Return(&models.Order{ID: 2}, nil).Once()
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	issuer, verifier := newTestIssuer(t)
+	token, err := issuer.Issue(auth.Principal{Subject: auth.UserSubject(7)})
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.NewHTTPErrorHandler(slog.Default())
+	e.POST("/orders", handler.PlaceOrder)
+	e.Use(middleware.AuthMiddleware(verifier, []string{"POST /orders"}))
+
+	for _, token := range []string{token, ""} {
+		req, rec := postJSON("/orders", `{"items":[{"product_id":1,"quantity":1}]}`)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRegisterAuthRoutes_NoIssuer(t *testing.T) {
+	// Deployments accepting only external tokens have no issuer, and no customer accounts
+	handler := handlers.NewAuthHandler(services.NewAuthService(new(mocks.MockUserRepository), new(mocks.MockRefreshTokenRepository), nil, slog.Default()), slog.Default())
+	e := echo.New()
+	handler.RegisterAuthRoutes(e)
+
+	var paths []string
+	for _, route := range e.Routes() {
+		paths = append(paths, route.Path)
+	}
+	assert.Equal(t, []string{"/users/:id/role"}, paths)
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guregu/null"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	repo := new(mocks.MockAPIKeyRepository)
+	var stored models.APIKey
+	inserted := &models.APIKey{}
+	repo.On("CreateAPIKey", mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(models.APIKey)
+		*inserted = stored
+		inserted.ID = 3
+	}).Return(inserted, nil)
+	handler := handlers.NewAPIKeyHandler(services.NewAPIKeyService(repo, slog.Default()), slog.Default())
+
+	req, _ := postJSON("/api-keys", `{"name":" Aggregator ","scopes":["orders:place"]}`)
+	rec := serveAs(&auth.Principal{Subject: "1", Roles: []string{auth.RolePlatformAdmin}}, handler.CreateAPIKey, req, "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created models.CreatedAPIKey
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, 3, created.ID)
+	assert.Equal(t, "Aggregator", created.Name)
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.Equal(t, sha256Hex(created.Key), stored.KeyHash, "only the hash of the key is stored")
+	assert.Equal(t, "1", stored.CreatedBy)
+	assert.NotContains(t, rec.Body.String(), stored.KeyHash)
+}
+
+func TestCreateAPIKeyHandler_Invalid(t *testing.T) {
+	repo := new(mocks.MockAPIKeyRepository)
+	handler := handlers.NewAPIKeyHandler(services.NewAPIKeyService(repo, slog.Default()), slog.Default())
+
+	req, _ := postJSON("/api-keys", `{"name":"","scopes":["orders:place","orders:delete"],"expires_at":"2020-01-01T00:00:00Z"}`)
+	rec := serveAs(nil, handler.CreateAPIKey, req, "")
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var fields []string
+	for _, detail := range decodeError(t, rec).Details {
+		fields = append(fields, detail.Field)
+	}
+	assert.Equal(t, []string{"name", "scopes[1]", "expires_at"}, fields)
+	repo.AssertNotCalled(t, "CreateAPIKey", mock.Anything)
+}
+
+func TestRevokeAPIKeyHandler_NotFound(t *testing.T) {
+	repo := new(mocks.MockAPIKeyRepository)
+	repo.On("RevokeAPIKey", 9).Return(fmt.Errorf("failed to revoke API key ID 9: %w", sql.ErrNoRows))
+	handler := handlers.NewAPIKeyHandler(services.NewAPIKeyService(repo, slog.Default()), slog.Default())
+
+	rec := serveAs(nil, handler.RevokeAPIKey, httptest.NewRequest(http.MethodDelete, "/api-keys/9", nil), "9")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	const (
+		ordering = "ofo_ordering"
+		reading  = "ofo_reading"
+		revoked  = "ofo_revoked"
+		expired  = "ofo_expired"
+	)
+	repo := new(mocks.MockAPIKeyRepository)
+	repo.On("GetAPIKeyByHash", sha256Hex(ordering)).Return(&models.APIKey{ID: 1, Name: "Aggregator", Scopes: []string{"orders:place"}}, nil)
+	repo.On("GetAPIKeyByHash", sha256Hex(reading)).Return(&models.APIKey{ID: 2, Scopes: []string{"orders:read_all"}}, nil)
+	repo.On("GetAPIKeyByHash", sha256Hex(revoked)).Return(&models.APIKey{ID: 3, RevokedAt: null.TimeFrom(time.Now())}, nil)
+	repo.On("GetAPIKeyByHash", sha256Hex(expired)).Return(&models.APIKey{ID: 4, ExpiresAt: null.TimeFrom(time.Now().Add(-time.Hour))}, nil)
+	repo.On("GetAPIKeyByHash", mock.Anything).Return(nil, fmt.Errorf("failed to fetch API key: %w", sql.ErrNoRows))
+	repo.On("TouchAPIKey", mock.Anything, mock.Anything).Return(nil)
+	service := services.NewAPIKeyService(repo, slog.Default())
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: testJWTSecret})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.NewHTTPErrorHandler(slog.Default())
+	e.POST("/orders", func(c echo.Context) error {
+		return c.String(http.StatusCreated, fmt.Sprintf("%s %d", middleware.Actor(c), middleware.Principal(c).APIKeyID))
+	}, middleware.RequirePermission(auth.PermPlaceOrders))
+	e.Use(middleware.APIKeyMiddleware(service))
+	e.Use(middleware.AuthMiddleware(verifier, nil))
+
+	post := func(key, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(ordering, "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "api_key:1 1", rec.Body.String())
+	repo.AssertCalled(t, "TouchAPIKey", 1, mock.Anything)
+
+	assert.Equal(t, http.StatusForbidden, post(reading, "").Code, "keys only grant their scopes")
+	assert.Equal(t, http.StatusUnauthorized, post(revoked, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, post("ofo_unknown", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, post("not-a-key", "").Code)
+
+	rec = post(expired, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "API key has expired", decodeError(t, rec).Message)
+
+	assert.Equal(t, http.StatusBadRequest, post(ordering, signHS256(t, validClaims())).Code)
+	assert.Equal(t, http.StatusCreated, post("", signHS256(t, validClaims())).Code)
+	repo.AssertNotCalled(t, "TouchAPIKey", 3, mock.Anything)
+}
+
+func TestPlaceOrderHandler_RecordsAPIKey(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("PlaceOrder", mock.MatchedBy(func(req models.OrderRequest) bool {
+		return req.APIKeyID.Int64 == 1 && !req.CustomerID.Valid
+	}), mock.Anything).Return(&models.Order{ID: 1, APIKeyID: null.IntFrom(1)}, nil).Once()
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	req, _ := postJSON("/orders", `{"items":[{"product_id":1,"quantity":1}]}`)
+	rec := serveAs(partner, handler.PlaceOrder, req, "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	mockRepo.AssertExpectations(t)
+}
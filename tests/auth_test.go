@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testJWTSecret = []byte("test-secret")
+
+// signHS256 signs claims with the test secret.
+func signHS256(t testing.TB, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testJWTSecret)
+	require.NoError(t, err)
+	return token
+}
+
+// validClaims returns claims for a customer, valid for an hour.
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "42", "name": "Ada", "roles": []string{"customer"}, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+// newAuthServer returns an Echo server authenticating requests with verifier, with a public
+// /health route and a private /whoami route echoing the principal.
+func newAuthServer(verifier *auth.Verifier) *echo.Echo {
+	e := echo.New()
+	e.GET("/health", func(c echo.Context) error { return c.String(http.StatusOK, "OK") })
+	e.GET("/whoami", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, middleware.Principal(c))
+	})
+	e.DELETE("/products/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }, middleware.RequireRole("admin"))
+	e.Use(middleware.AuthMiddleware(verifier, []string{"/health"}))
+	return e
+}
+
+func request(e *echo.Echo, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthMiddleware_HS256(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: testJWTSecret})
+	require.NoError(t, err)
+	e := newAuthServer(verifier)
+
+	rec := request(e, http.MethodGet, "/whoami", signHS256(t, validClaims()))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var principal auth.Principal
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &principal))
+	assert.Equal(t, "42", principal.Subject)
+	assert.Equal(t, "Ada", principal.Name)
+	assert.Equal(t, []string{"customer"}, principal.Roles)
+	_, ok := principal.UserID()
+	assert.False(t, ok, "only subjects of the API's own tokens name customer accounts")
+}
+
+func TestAuthMiddleware_PublicRoute(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: testJWTSecret})
+	require.NoError(t, err)
+	e := newAuthServer(verifier)
+
+	assert.Equal(t, http.StatusOK, request(e, http.MethodGet, "/health", "").Code)
+
+	rec := request(e, http.MethodGet, "/whoami", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="order_food_online"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+}
+
+func TestAuthMiddleware_RejectedTokens(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: testJWTSecret, Issuer: "https://auth.example.com"})
+	require.NoError(t, err)
+	e := newAuthServer(verifier)
+
+	issued := func(claims jwt.MapClaims) jwt.MapClaims {
+		claims["iss"] = "https://auth.example.com"
+		return claims
+	}
+	expired := issued(validClaims())
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	noExpiry := issued(validClaims())
+	delete(noExpiry, "exp")
+	wrongSecret, err := jwt.NewWithClaims(jwt.SigningMethodHS256, issued(validClaims())).SignedString([]byte("other-secret"))
+	require.NoError(t, err)
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, issued(validClaims())).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"garbage":      "not-a-token",
+		"expired":      signHS256(t, expired),
+		"no expiry":    signHS256(t, noExpiry),
+		"wrong issuer": signHS256(t, validClaims()),
+		"wrong secret": wrongSecret,
+		"alg none":     unsigned,
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Invalid tokens are rejected even on public routes
+			for _, path := range []string{"/whoami", "/health"} {
+				rec := request(e, http.MethodGet, path, token)
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+				assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), `error="invalid_token"`)
+			}
+		})
+	}
+
+	rec := request(e, http.MethodGet, "/whoami", signHS256(t, expired))
+	assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), "token has expired")
+}
+
+func TestAuthMiddleware_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// Publish the public key in a local key set, next to a key meant for encryption
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{
+			"kty": "RSA", "kid": "key-1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		},
+	}}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	verifier, err := auth.NewVerifier(auth.Config{JWKSFile: path, Audience: "orders-api"})
+	require.NoError(t, err)
+	e := newAuthServer(verifier)
+
+	sign := func(kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+	claims := validClaims()
+	claims["aud"] = []string{"orders-api", "other-api"}
+
+	assert.Equal(t, http.StatusOK, request(e, http.MethodGet, "/whoami", sign("key-1", claims)).Code)
+	assert.Equal(t, http.StatusUnauthorized, request(e, http.MethodGet, "/whoami", sign("key-2", claims)).Code)
+	assert.Equal(t, http.StatusUnauthorized, request(e, http.MethodGet, "/whoami", sign("key-1", validClaims())).Code)
+	// Other issuers can't authenticate customer accounts
+	customer := validClaims()
+	customer["aud"] = "orders-api"
+	customer["sub"] = auth.UserSubject(42)
+	assert.Equal(t, http.StatusUnauthorized, request(e, http.MethodGet, "/whoami", sign("key-1", customer)).Code)
+	_, err = verifier.Verify(sign("key-1", customer))
+	assert.ErrorIs(t, err, auth.ErrReservedSubject)
+	// HS256 is not accepted when no secret is configured
+	assert.Equal(t, http.StatusUnauthorized, request(e, http.MethodGet, "/whoami", signHS256(t, claims)).Code)
+}
+
+func TestRequireRole(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: testJWTSecret})
+	require.NoError(t, err)
+	e := newAuthServer(verifier)
+
+	assert.Equal(t, http.StatusUnauthorized, request(e, http.MethodDelete, "/products/1", "").Code)
+
+	rec := request(e, http.MethodDelete, "/products/1", signHS256(t, validClaims()))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), `error="insufficient_scope"`)
+
+	admin := validClaims()
+	admin["roles"] = []string{"admin"}
+	assert.Equal(t, http.StatusNoContent, request(e, http.MethodDelete, "/products/1", signHS256(t, admin)).Code)
+}
+
+func TestNewVerifier_NoKeys(t *testing.T) {
+	_, err := auth.NewVerifier(auth.Config{})
+	assert.ErrorIs(t, err, auth.ErrNoVerificationKeys)
+}
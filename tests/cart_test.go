@@ -0,0 +1,354 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/cache"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guregu/null"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCartCache keeps carts in memory, along with the TTL they were last stored with.
+type memoryCartCache struct {
+	carts map[string]models.Cart
+	ttl   time.Duration
+}
+
+func (m *memoryCartCache) GetCart(owner models.CartOwner) (*models.Cart, error) {
+	cart, ok := m.carts[owner.Key()]
+	if !ok {
+		return nil, nil
+	}
+	cart.Items = append([]models.CartItem{}, cart.Items...)
+	return &cart, nil
+}
+
+func (m *memoryCartCache) UpdateCart(owner models.CartOwner, ttl time.Duration, change func(*models.Cart) error) (*models.Cart, error) {
+	cart, _ := m.GetCart(owner)
+	if cart == nil {
+		cart = &models.Cart{Items: []models.CartItem{}}
+	}
+	if err := change(cart); err != nil {
+		return nil, err
+	}
+	m.carts[owner.Key()] = *cart
+	m.ttl = ttl
+	return cart, nil
+}
+
+func (m *memoryCartCache) MergeCart(from, into models.CartOwner, ttl time.Duration, merge func(into, from *models.Cart) error) error {
+	source, _ := m.GetCart(from)
+	if source == nil {
+		return nil
+	}
+	if _, err := m.UpdateCart(into, ttl, func(cart *models.Cart) error { return merge(cart, source) }); err != nil {
+		return err
+	}
+	delete(m.carts, from.Key())
+	return nil
+}
+
+func (m *memoryCartCache) DeleteCart(owner models.CartOwner, revision string) error {
+	if cart, ok := m.carts[owner.Key()]; ok && cart.Revision != revision {
+		return cache.ErrCartChanged
+	}
+	delete(m.carts, owner.Key())
+	return nil
+}
+
+// catalogOf serves the given products to GetProductsByIDs, leaving out the IDs it doesn't have.
+func catalogOf(products ...models.Product) func([]int) []models.Product {
+	return func(ids []int) []models.Product {
+		found := []models.Product{}
+		for _, product := range products {
+			for _, id := range ids {
+				if product.ID == id {
+					found = append(found, product)
+					break
+				}
+			}
+		}
+		return found
+	}
+}
+
+const testGuestID = "0123456789abcdef0123456789abcdef"
+
+type cartFixture struct {
+	carts    *memoryCartCache
+	products *mocks.MockProductRepository
+	orders   *mocks.MockOrderService
+	handler  *handlers.CartHandler
+}
+
+// newCartFixture serves a catalog of a burger at 8.50 and a sold out salad.
+func newCartFixture(t *testing.T) *cartFixture {
+	products := new(mocks.MockProductRepository)
+	burger := models.Product{ID: 1, Name: "Burger", Price: 850, Available: true}
+	salad := models.Product{ID: 2, Name: "Salad", Price: 600, Stock: null.IntFrom(0)}
+	products.On("GetProductByID", 1).Return(&burger, nil)
+	products.On("GetProductByID", 2).Return(&salad, nil)
+	products.On("GetProductByID", mock.Anything).Return(nil, sql.ErrNoRows)
+	products.On("GetProductsByIDs", mock.Anything).Return(catalogOf(burger, salad), nil)
+
+	promoCache := new(mocks.MockPromoCodeCache)
+	promoCache.On("GetPromoCode", mock.Anything).Return(nil, nil)
+	promoCache.On("SetPromoCode", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	promoCodes := new(mocks.MockPromoCodeRepository)
+	promoCodes.On("GetPromoCode", mock.Anything).Return(nil, nil)
+
+	fixture := &cartFixture{
+		carts:    &memoryCartCache{carts: map[string]models.Cart{}},
+		products: products,
+		orders:   new(mocks.MockOrderService),
+	}
+	currencies := newCurrencyService()
+	service := services.NewCartService(
+		fixture.carts,
+		products,
+		newPromoCodeService(t, promoCache, promoCodes, products),
+		services.NewOrderService(fixture.orders, currencies),
+		currencies,
+		slog.Default(),
+	)
+	fixture.handler = handlers.NewCartHandler(service, slog.Default())
+	return fixture
+}
+
+// serve calls a cart handler as the principal, with the guest ID in the X-Cart-ID header
+// when it is not empty.
+func (f *cartFixture) serve(principal *auth.Principal, guestID string, h echo.HandlerFunc, method, body, productID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/cart", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if guestID != "" {
+		req.Header.Set("X-Cart-ID", guestID)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if productID != "" {
+		c.SetParamNames("product_id")
+		c.SetParamValues(productID)
+	}
+	if principal != nil {
+		middleware.SetPrincipal(c, principal)
+	}
+	serve(c, h)
+	return rec
+}
+
+func decodeCart(t *testing.T, rec *httptest.ResponseRecorder) models.CartView {
+	var cart models.CartView
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cart))
+	return cart
+}
+
+func TestCartHandler_GuestCart(t *testing.T) {
+	f := newCartFixture(t)
+
+	rec := f.serve(nil, "", f.handler.AddItem, http.MethodPost, `{"product_id":1,"quantity":2}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	guestID := rec.Header().Get("X-Cart-ID")
+	assert.True(t, models.IsGuestID(guestID))
+	cart := decodeCart(t, rec)
+	assert.Equal(t, guestID, cart.GuestID)
+	assert.Equal(t, models.Money(1700), cart.Subtotal)
+	assert.Equal(t, 7*24*time.Hour, f.carts.ttl)
+
+	rec = f.serve(nil, guestID, f.handler.AddItem, http.MethodPost, `{"product_id":1,"quantity":1}`, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = f.serve(nil, guestID, f.handler.UpdateItem, http.MethodPatch, `{"quantity":4}`, "1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	cart = decodeCart(t, f.serve(nil, guestID, f.handler.GetCart, http.MethodGet, "", ""))
+	require.Len(t, cart.Items, 1)
+	assert.Equal(t, models.CartLine{ProductID: 1, ProductName: "Burger", Quantity: 4, Price: 850, LineTotal: 3400, Available: true}, cart.Items[0])
+	assert.Equal(t, models.Money(3400), cart.Total)
+	assert.Equal(t, "USD", cart.Currency)
+
+	rec = f.serve(nil, guestID, f.handler.RemoveItem, http.MethodDelete, "", "1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, decodeCart(t, rec).Items)
+}
+
+func TestCartHandler_GetCartWithoutCart(t *testing.T) {
+	f := newCartFixture(t)
+
+	rec := f.serve(nil, "", f.handler.GetCart, http.MethodGet, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("X-Cart-ID"))
+	assert.Empty(t, decodeCart(t, rec).Items)
+	assert.Empty(t, f.carts.carts)
+}
+
+func TestCartHandler_PricesAreLive(t *testing.T) {
+	f := newCartFixture(t)
+	f.carts.carts["user:7"] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 1}, {ProductID: 3, Quantity: 1}}}
+
+	cart := decodeCart(t, f.serve(customer7, "", f.handler.GetCart, http.MethodGet, "", ""))
+	require.Len(t, cart.Items, 3)
+	assert.True(t, cart.Items[0].Available)
+	assert.False(t, cart.Items[1].Available, "sold out products are flagged")
+	assert.False(t, cart.Items[2].Available, "products that left the catalog are flagged")
+	assert.Equal(t, models.Money(850), cart.Subtotal)
+
+	// The catalog price changes after the product was added
+	f.products.ExpectedCalls = nil
+	f.products.On("GetProductsByIDs", mock.Anything).Return(catalogOf(models.Product{ID: 1, Name: "Burger", Price: 900, Available: true}), nil)
+	cart = decodeCart(t, f.serve(customer7, "", f.handler.GetCart, http.MethodGet, "", ""))
+	assert.Equal(t, models.Money(900), cart.Items[0].Price)
+}
+
+func TestCartHandler_RejectedChanges(t *testing.T) {
+	f := newCartFixture(t)
+
+	tests := []struct {
+		name      string
+		h         echo.HandlerFunc
+		method    string
+		body      string
+		productID string
+		guestID   string
+		status    int
+		code      string
+	}{
+		{"unknown product", f.handler.AddItem, http.MethodPost, `{"product_id":3,"quantity":1}`, "", "", http.StatusBadRequest, handlers.CodeValidationFailed},
+		{"sold out product", f.handler.AddItem, http.MethodPost, `{"product_id":2,"quantity":1}`, "", "", http.StatusConflict, handlers.CodeOutOfStock},
+		{"invalid quantity", f.handler.AddItem, http.MethodPost, `{"product_id":1,"quantity":101}`, "", "", http.StatusBadRequest, handlers.CodeValidationFailed},
+		{"line not in cart", f.handler.UpdateItem, http.MethodPatch, `{"quantity":1}`, "1", "", http.StatusNotFound, handlers.CodeNotFound},
+		{"zero quantity", f.handler.UpdateItem, http.MethodPatch, `{"quantity":0}`, "1", "", http.StatusBadRequest, handlers.CodeValidationFailed},
+		{"remove line not in cart", f.handler.RemoveItem, http.MethodDelete, "", "1", "", http.StatusNotFound, handlers.CodeNotFound},
+		{"invalid product ID", f.handler.RemoveItem, http.MethodDelete, "", "burger", "", http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"forged cart ID", f.handler.GetCart, http.MethodGet, "", "", "../user:7", http.StatusBadRequest, handlers.CodeValidationFailed},
+		{"unknown coupon", f.handler.ApplyCoupon, http.MethodPut, `{"code":"NOTACODE1"}`, "", "", http.StatusBadRequest, "coupon_" + models.CouponReasonUnknownCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := f.serve(nil, tt.guestID, tt.h, tt.method, tt.body, tt.productID)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.code, decodeError(t, rec).Code)
+		})
+	}
+	assert.Empty(t, f.carts.carts)
+}
+
+func TestCartHandler_Coupon(t *testing.T) {
+	f := newCartFixture(t)
+	f.carts.carts["user:7"] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 1}}}
+
+	// PROMO123 appears in two coupon bases and carries no discount rule
+	rec := f.serve(customer7, "", f.handler.ApplyCoupon, http.MethodPut, `{"code":"PROMO123"}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	cart := decodeCart(t, rec)
+	assert.Equal(t, "PROMO123", cart.CouponCode)
+	require.NotNil(t, cart.Coupon)
+	assert.True(t, cart.Coupon.Valid)
+	assert.Equal(t, "PROMO123", f.carts.carts["user:7"].CouponCode)
+
+	rec = f.serve(customer7, "", f.handler.RemoveCoupon, http.MethodDelete, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, decodeCart(t, rec).Coupon)
+	assert.Empty(t, f.carts.carts["user:7"].CouponCode)
+}
+
+func TestCartHandler_MergesGuestCartOnLogin(t *testing.T) {
+	f := newCartFixture(t)
+	f.carts.carts["guest:"+testGuestID] = models.Cart{
+		Items:      []models.CartItem{{ProductID: 1, Quantity: 99}, {ProductID: 2, Quantity: 1}},
+		CouponCode: "PROMO123",
+	}
+	f.carts.carts["user:7"] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 3}}}
+
+	rec := f.serve(customer7, testGuestID, f.handler.GetCart, http.MethodGet, "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	cart := decodeCart(t, rec)
+	assert.Empty(t, cart.GuestID)
+	assert.Empty(t, rec.Header().Get("X-Cart-ID"))
+	require.Len(t, cart.Items, 2)
+	assert.Equal(t, models.MaxItemQuantity, cart.Items[0].Quantity, "merged quantities stay within the order limits")
+	assert.Equal(t, 2, cart.Items[1].ProductID)
+	assert.Equal(t, "PROMO123", cart.CouponCode)
+	assert.NotContains(t, f.carts.carts, "guest:"+testGuestID)
+
+	// The guest ID is still sent by the client, but there is nothing left to merge
+	cart = decodeCart(t, f.serve(customer7, testGuestID, f.handler.GetCart, http.MethodGet, "", ""))
+	assert.Equal(t, models.MaxItemQuantity, cart.Items[0].Quantity)
+}
+
+func TestCartHandler_Checkout(t *testing.T) {
+	f := newCartFixture(t)
+	f.carts.carts["user:7"] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 2}}, Revision: "r1"}
+	f.orders.On("PlaceOrder", mock.MatchedBy(func(orderReq models.OrderRequest) bool {
+		return orderReq.CustomerID.Int64 == 7 && orderReq.IdempotencyKey == "cart-r1" &&
+			len(orderReq.Items) == 1 && orderReq.Items[0].ProductID == 1 && orderReq.Items[0].Quantity == 2
+	}), mock.Anything).Return(&models.Order{ID: 12}, nil)
+
+	rec := f.serve(customer7, "", f.handler.Checkout, http.MethodPost, "", "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"id":12`)
+	assert.NotContains(t, f.carts.carts, "user:7", "the cart is emptied")
+	f.orders.AssertExpectations(t)
+
+	rec = f.serve(customer7, "", f.handler.Checkout, http.MethodPost, "", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "items", decodeError(t, rec).Details[0].Field)
+	f.orders.AssertNumberOfCalls(t, "PlaceOrder", 1)
+}
+
+func TestCartHandler_CheckoutWithAPIKey(t *testing.T) {
+	f := newCartFixture(t)
+	f.carts.carts["guest:"+testGuestID] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 1}}, Revision: "r1"}
+	f.orders.On("PlaceOrder", mock.MatchedBy(func(orderReq models.OrderRequest) bool {
+		return orderReq.APIKeyID.Int64 == 1 && !orderReq.CustomerID.Valid
+	}), mock.Anything).Return(&models.Order{ID: 12}, nil)
+
+	// The order belongs to the partner's key, so the partner can see it afterwards
+	rec := f.serve(partner, testGuestID, f.handler.Checkout, http.MethodPost, "", "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotContains(t, f.carts.carts, "guest:"+testGuestID)
+	f.orders.AssertExpectations(t)
+}
+
+func TestCartHandler_CheckoutKeepsLinesAddedMeanwhile(t *testing.T) {
+	f := newCartFixture(t)
+	f.carts.carts["user:7"] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 2}}, Revision: "r1"}
+	f.orders.On("PlaceOrder", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+		// Another request adds a line while the order is placed
+		f.carts.carts["user:7"] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 3}}, Revision: "r2"}
+	}).Return(&models.Order{ID: 12}, nil)
+
+	rec := f.serve(customer7, "", f.handler.Checkout, http.MethodPost, "", "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "r2", f.carts.carts["user:7"].Revision, "the changed cart is kept")
+}
+
+func TestCartHandler_CheckoutUnavailableItems(t *testing.T) {
+	f := newCartFixture(t)
+	f.carts.carts["user:7"] = models.Cart{Items: []models.CartItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 1}, {ProductID: 3, Quantity: 1}}, Revision: "r1"}
+
+	rec := f.serve(customer7, "", f.handler.Checkout, http.MethodPost, "", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	apiErr := decodeError(t, rec)
+	assert.Equal(t, handlers.CodeOutOfStock, apiErr.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "items[1].product_id", Message: "Salad is sold out"},
+		{Field: "items[2].product_id", Message: "product with ID 3 is no longer on the menu"},
+	}, apiErr.Details)
+	f.orders.AssertNotCalled(t, "PlaceOrder", mock.Anything, mock.Anything)
+	assert.Contains(t, f.carts.carts, "user:7")
+}
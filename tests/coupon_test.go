@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"compress/gzip"
+	"order_food_online/internal/repository"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGzipCouponBase(t *testing.T, path string, codes ...string) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	_, err = gz.Write([]byte(strings.Join(codes, "\n") + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+}
+
+func TestCouponRepository_ReadsGzipBases(t *testing.T) {
+	dir := t.TempDir()
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase1.gz"), "SUMMER2024", "ONLYFIRST1", "HALFOFF10")
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase2.gz"), "HALFOFF10", "SUMMER2024", "SUMMER2024")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "couponbase3.txt"), []byte("SUMMER2024\nONLYTHIRD1\n"), 0o644))
+
+	coupons, err := repository.NewCouponRepository(dir)
+	require.NoError(t, err)
+
+	assert.True(t, coupons.IsValid("SUMMER2024"))
+	assert.True(t, coupons.IsValid("HALFOFF10"))
+	assert.False(t, coupons.IsValid("ONLYFIRST1"))
+	assert.False(t, coupons.IsValid("ONLYTHIRD1"))
+	assert.False(t, coupons.IsValid("SHORT"))
+	assert.Equal(t, 2, coupons.Len())
+}
+
+func TestCouponRepository_PrefersGzipBases(t *testing.T) {
+	// Plain copies left next to the archives are ignored
+	dir := t.TempDir()
+	for _, base := range []string{"couponbase1", "couponbase2", "couponbase3"} {
+		writeGzipCouponBase(t, filepath.Join(dir, base+".gz"), "SUMMER2024")
+		require.NoError(t, os.WriteFile(filepath.Join(dir, base+".txt"), []byte("STALE2023\n"), 0o644))
+	}
+
+	coupons, err := repository.NewCouponRepository(dir)
+	require.NoError(t, err)
+	assert.True(t, coupons.IsValid("SUMMER2024"))
+	assert.False(t, coupons.IsValid("STALE2023"))
+	require.Len(t, coupons.Status().Files, 3)
+	for _, base := range coupons.Status().Files {
+		assert.Equal(t, ".gz", filepath.Ext(base.Name))
+	}
+}
+
+func TestCouponRepository_MissingBase(t *testing.T) {
+	_, err := repository.NewCouponRepository(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestCouponRepository_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeBase := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	writeBase("couponbase1.txt", "KEEPME123\nDROPME123\n")
+	writeBase("couponbase2.txt", "KEEPME123\nDROPME123\n")
+	writeBase("couponbase3.txt", "NEWCODE12\n")
+
+	coupons, err := repository.NewCouponRepository(dir)
+	require.NoError(t, err)
+	assert.True(t, coupons.IsValid("DROPME123"))
+	assert.False(t, coupons.IsValid("NEWCODE12"))
+
+	writeBase("couponbase2.txt", "KEEPME123\nNEWCODE12\n")
+	changed, err := coupons.Reload()
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"DROPME123", "NEWCODE12"}, changed)
+	assert.True(t, coupons.IsValid("KEEPME123"))
+	assert.True(t, coupons.IsValid("NEWCODE12"))
+	assert.False(t, coupons.IsValid("DROPME123"))
+
+	status := coupons.Status()
+	assert.Equal(t, 2, status.Codes)
+	assert.Len(t, status.Files, 3)
+}
+
+func TestCouponRepository_ReloadKeepsIndexOnError(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"couponbase1.txt", "couponbase2.txt", "couponbase3.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("PROMO123\n"), 0o644))
+	}
+
+	coupons, err := repository.NewCouponRepository(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "couponbase2.txt")))
+	_, err = coupons.Reload()
+	assert.Error(t, err)
+	assert.True(t, coupons.IsValid("PROMO123"))
+}
@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newCurrencyService returns a service with USD as base currency, knowing only the given rates.
+func newCurrencyService(rates ...models.ExchangeRate) *services.CurrencyService {
+	mockRates := new(mocks.MockExchangeRateRepository)
+	for i := range rates {
+		mockRates.On("GetRate", rates[i].Currency).Return(&rates[i], nil)
+	}
+	mockRates.On("GetRate", mock.Anything).Return(nil, nil)
+	return services.NewCurrencyService(mockRates)
+}
+
+func TestCurrencyConverter(t *testing.T) {
+	service := newCurrencyService(models.ExchangeRate{Currency: "EUR", Rate: 920000})
+
+	eur, err := service.Converter("eur")
+	require.NoError(t, err)
+
+	product := models.Product{ID: 1, Price: 1000, Prices: models.Prices{"GBP": 850}}
+	localProduct, err := eur.Product(product)
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(920), localProduct.Price)
+	assert.Equal(t, "EUR", localProduct.Currency)
+	assert.Equal(t, models.Money(1000), product.Price, "the original product is left untouched")
+
+	// 1.00 EUR is 1.0869... USD
+	assert.Equal(t, models.Money(109), eur.ConvertBack(100))
+
+	usd, err := service.Converter("")
+	require.NoError(t, err)
+	localProduct, err = usd.Product(product)
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(1000), localProduct.Price)
+
+	// Without a rate, only native prices can be given
+	gbp, err := service.Converter("GBP")
+	require.NoError(t, err)
+	assert.False(t, gbp.HasRate())
+	localProduct, err = gbp.Product(product)
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(850), localProduct.Price)
+	_, err = gbp.Product(models.Product{ID: 2, Price: 1000})
+	assert.ErrorIs(t, err, models.ErrUnsupportedCurrency)
+
+	_, err = service.Converter("euro")
+	assert.ErrorIs(t, err, models.ErrInvalidCurrency)
+}
+
+func TestCurrencyConverter_NativePrice(t *testing.T) {
+	gbp := models.CurrencyConverter{Currency: "GBP", Rate: 790000}
+
+	product := models.Product{ID: 1, Price: 1000, Prices: models.Prices{"GBP": 850}}
+	localProduct, err := gbp.Product(product)
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(850), localProduct.Price)
+
+	// Percentages stay as they are, amounts are converted
+	promo, err := gbp.PromoCode(models.PromoCode{DiscountType: models.DiscountFixed, DiscountValue: 500, MinOrderValue: 2000})
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(395), promo.DiscountValue)
+	assert.Equal(t, models.Money(1580), promo.MinOrderValue)
+	promo, err = gbp.PromoCode(models.PromoCode{DiscountType: models.DiscountPercentage, DiscountValue: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(1000), promo.DiscountValue)
+
+	// Without a rate, only coupons without amounts apply
+	noRate := models.CurrencyConverter{Currency: "GBP"}
+	_, err = noRate.PromoCode(models.PromoCode{DiscountType: models.DiscountPercentage, DiscountValue: 1000})
+	assert.NoError(t, err)
+	_, err = noRate.PromoCode(models.PromoCode{DiscountType: models.DiscountPercentage, DiscountValue: 1000, MaxDiscount: 500})
+	assert.ErrorIs(t, err, models.ErrUnsupportedCurrency)
+}
+
+func TestGetProductsHandler_Currency(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+
+	// The price filter applies to prices in the requested currency
+	mockRepo.On("ListProducts", models.ProductQuery{
+		Limit:         models.DefaultPageSize,
+		MinPrice:      models.NewNullMoney(920),
+		Sort:          models.ProductSortID,
+		PriceCurrency: "EUR",
+		PriceRate:     920000,
+	}).Return(&models.ProductPage{
+		Items: []models.Product{{ID: 3, Name: "Margherita", Price: 850, Category: "pizza"}},
+		Total: 1,
+	}, nil)
+
+	service := services.NewProductService(mockRepo, newCurrencyService(models.ExchangeRate{Currency: "EUR", Rate: 920000}))
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/products?min_price=9.20&currency=eur", nil)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, handler.GetProducts(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"price":7.82`)
+		assert.Contains(t, rec.Body.String(), `"currency":"EUR"`)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetProductsHandler_UnsupportedCurrency(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+	mockRepo.On("ListProducts", mock.Anything).Return(&models.ProductPage{
+		Items: []models.Product{
+			{ID: 1, Name: "Ramen", Price: 1200, Category: "soup", Prices: models.Prices{"JPY": 180000}},
+			{ID: 2, Name: "Margherita", Price: 850, Category: "pizza"},
+		},
+		Total: 2,
+	}, nil)
+
+	service := services.NewProductService(mockRepo, newCurrencyService())
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/products?currency=JPY", nil)
+	rec := httptest.NewRecorder()
+
+	// The second product has no JPY price, and there is no rate to convert its price with
+	c := e.NewContext(req, rec)
+	serve(c, handler.GetProducts)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGetProductsHandler_NativePricesWithoutRate(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+	mockRepo.On("ListProducts", models.ProductQuery{
+		Limit:         models.DefaultPageSize,
+		MaxPrice:      models.NewNullMoney(200000),
+		Sort:          models.ProductSortID,
+		PriceCurrency: "JPY",
+	}).Return(&models.ProductPage{
+		Items: []models.Product{{ID: 1, Name: "Ramen", Price: 1200, Category: "soup", Prices: models.Prices{"JPY": 180000}}},
+		Total: 1,
+	}, nil)
+
+	service := services.NewProductService(mockRepo, newCurrencyService())
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	// JPY has no rate, but every product listed has a JPY price
+	req := httptest.NewRequest(http.MethodGet, "/products?max_price=2000&currency=JPY", nil)
+	rec := httptest.NewRecorder()
+	serve(echo.New().NewContext(req, rec), handler.GetProducts)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"price":1800`)
+	assert.Contains(t, rec.Body.String(), `"currency":"JPY"`)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPlaceOrder_Currency(t *testing.T) {
+	eur := models.CurrencyConverter{Currency: "EUR", Rate: 920000}
+
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("PlaceOrder", mock.MatchedBy(func(orderReq models.OrderRequest) bool {
+		return orderReq.Currency == "EUR"
+	}), eur).Return(&models.Order{ID: 1, Currency: "EUR"}, nil)
+
+	service := services.NewOrderService(mockRepo, newCurrencyService(models.ExchangeRate{Currency: "EUR", Rate: 920000}))
+
+	order, err := service.PlaceOrder(models.OrderRequest{
+		Items:    []models.OrderItem{{ProductID: 1, Quantity: 1}},
+		Currency: "eur",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", order.Currency)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"order_food_online/internal/models"
+	"testing"
+	"time"
+
+	"github.com/guregu/null"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromoCodeDiscount(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: 1, Quantity: 2, Price: 1050},
+		{ProductID: 2, Quantity: 1, Price: 400},
+	}
+	categories := map[int]string{1: "pizza", 2: "drinks"}
+
+	tests := []struct {
+		name     string
+		promo    models.PromoCode
+		expected models.Money
+	}{
+		{"percentage", models.PromoCode{DiscountType: models.DiscountPercentage, DiscountValue: 1000}, 250},
+		{"percentage with cap", models.PromoCode{DiscountType: models.DiscountPercentage, DiscountValue: 5000, MaxDiscount: 500}, 500},
+		{"fixed", models.PromoCode{DiscountType: models.DiscountFixed, DiscountValue: 300}, 300},
+		{"fixed above subtotal", models.PromoCode{DiscountType: models.DiscountFixed, DiscountValue: 10000}, 2500},
+		{"free item in cart", models.PromoCode{DiscountType: models.DiscountFreeItem, FreeProductID: 1}, 1050},
+		{"free item not in cart", models.PromoCode{DiscountType: models.DiscountFreeItem, FreeProductID: 3}, 0},
+		{"category restricted", models.PromoCode{DiscountType: models.DiscountPercentage, DiscountValue: 5000, AllowedCategories: []string{"drinks"}}, 200},
+		{"product restricted", models.PromoCode{DiscountType: models.DiscountFixed, DiscountValue: 3000, AllowedProductIDs: []int{1}}, 2100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.promo.Discount(items, categories))
+		})
+	}
+}
+
+func TestPromoCodeCheck(t *testing.T) {
+	items := []models.OrderItem{{ProductID: 1, Quantity: 2, Price: 1000}}
+	categories := map[int]string{1: "pizza"}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		promo    models.PromoCode
+		expected string
+	}{
+		{"unrestricted", models.PromoCode{}, ""},
+		{"not started", models.PromoCode{StartsAt: null.TimeFrom(now.Add(time.Hour))}, models.CouponReasonNotStarted},
+		{"expired", models.PromoCode{EndsAt: null.TimeFrom(now)}, models.CouponReasonExpired},
+		{"within window", models.PromoCode{StartsAt: null.TimeFrom(now.Add(-time.Hour)), EndsAt: null.TimeFrom(now.Add(time.Hour))}, ""},
+		{"below minimum", models.PromoCode{MinOrderValue: 2500}, models.CouponReasonBelowMinimum},
+		{"at minimum", models.PromoCode{MinOrderValue: 2000}, ""},
+		{"no eligible items", models.PromoCode{AllowedCategories: []string{"drinks"}}, models.CouponReasonNoEligibleItems},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.promo.Check(items, categories, now))
+		})
+	}
+
+	// Unrestricted codes have no ineligible items, but an empty order has nothing to discount
+	unrestricted := models.PromoCode{}
+	assert.Equal(t, models.CouponReasonEmptyOrder, unrestricted.Check(nil, categories, now))
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"encoding/json"
+	"order_food_online/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected models.Money
+		wantErr  bool
+	}{
+		{"12", 1200, false},
+		{"12.5", 1250, false},
+		{"12.05", 1205, false},
+		{"0.1", 10, false},
+		{".99", 99, false},
+		{"-4.50", -450, false},
+		{"1.005", 0, true},
+		{"1e3", 0, true},
+		{"", 0, true},
+		{"abc", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := models.ParseMoney(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, models.ErrInvalidMoney)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, m)
+		})
+	}
+}
+
+func TestMoneyArithmeticIsExact(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: 1, Quantity: 3, Price: 10}, // 0.10
+		{ProductID: 2, Quantity: 1, Price: 20}, // 0.20
+	}
+	assert.Equal(t, "0.50", models.Subtotal(items).String())
+
+	// 12.5% of 0.99 is 0.12375, rounded half away from zero
+	assert.Equal(t, models.Money(12), models.Money(99).Percent(1250))
+	assert.Equal(t, models.Money(13), models.Money(100).Percent(1250))
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(models.Product{ID: 1, Name: "Lemonade", Price: 250})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"price":2.50`)
+
+	var product models.Product
+	require.NoError(t, json.Unmarshal(data, &product))
+	assert.Equal(t, models.Money(250), product.Price)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"price": 2.505}`), &product))
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m models.Money
+	require.NoError(t, m.Scan([]byte("99999999.99")))
+	assert.Equal(t, models.Money(9999999999), m)
+
+	var n models.NullMoney
+	require.NoError(t, n.Scan(nil))
+	assert.False(t, n.Valid)
+	require.NoError(t, n.Scan("0.30"))
+	assert.Equal(t, models.NewNullMoney(30), n)
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guregu/null"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	customer7 = &auth.Principal{Subject: auth.UserSubject(7), Roles: []string{auth.RoleCustomer}}
+	customer8 = &auth.Principal{Subject: auth.UserSubject(8), Roles: []string{auth.RoleCustomer}}
+	staff     = &auth.Principal{Subject: auth.UserSubject(1), Roles: []string{auth.RoleKitchenStaff}}
+	partner   = &auth.Principal{Subject: "api_key:1", Scopes: []string{string(auth.PermPlaceOrders)}, APIKeyID: 1}
+	partner2  = &auth.Principal{Subject: "api_key:2", Scopes: []string{string(auth.PermPlaceOrders)}, APIKeyID: 2}
+)
+
+// serveAs runs the handler for a request made by principal, nil for anonymous requests,
+// with the given :id route parameter.
+func serveAs(principal *auth.Principal, h echo.HandlerFunc, req *http.Request, id string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if id != "" {
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+	}
+	if principal != nil {
+		middleware.SetPrincipal(c, principal)
+	}
+	serve(c, h)
+	return rec
+}
+
+func TestGetMyOrdersHandler(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("ListOrders", models.OrderQuery{Limit: 5, CustomerID: 7}).
+		Return(&models.OrderPage{Items: []models.Order{{ID: 3, CustomerID: null.IntFrom(7)}}}, nil).Once()
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	rec := serveAs(customer7, handler.GetMyOrders, httptest.NewRequest(http.MethodGet, "/me/orders?limit=5", nil), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"customer_id":7`)
+
+	// Admins without a customer account have no orders of their own
+	rec = serveAs(&auth.Principal{Subject: "ops@example.com", Roles: []string{auth.RolePlatformAdmin}}, handler.GetMyOrders,
+		httptest.NewRequest(http.MethodGet, "/me/orders", nil), "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serveAs(nil, handler.GetMyOrders, httptest.NewRequest(http.MethodGet, "/me/orders", nil), "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetOrdersHandler_APIKey(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("ListOrders", models.OrderQuery{Limit: 5, APIKeyID: 1}).
+		Return(&models.OrderPage{Items: []models.Order{{ID: 3, APIKeyID: null.IntFrom(1)}}}, nil).Once()
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	rec := serveAs(partner, handler.GetOrders, httptest.NewRequest(http.MethodGet, "/orders?limit=5", nil), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"api_key_id":1`)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetOrderByIDHandler_Ownership(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("GetOrderByID", 1).Return(&models.Order{ID: 1, CustomerID: null.IntFrom(7)}, nil)
+	mockRepo.On("GetOrderByID", 2).Return(&models.Order{ID: 2}, nil)
+	mockRepo.On("GetOrderByID", 3).Return(&models.Order{ID: 3, APIKeyID: null.IntFrom(1)}, nil)
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		id        string
+		status    int
+		mine      int
+	}{
+		{"own order", customer7, "1", http.StatusOK, http.StatusOK},
+		{"another customer's order", customer8, "1", http.StatusNotFound, http.StatusNotFound},
+		{"staff", staff, "1", http.StatusOK, http.StatusNotFound},
+		{"anonymous", nil, "1", http.StatusNotFound, http.StatusUnauthorized},
+		{"guest order", customer8, "2", http.StatusNotFound, http.StatusNotFound},
+		{"guest order, staff", staff, "2", http.StatusOK, http.StatusNotFound},
+		{"guest order, API key", partner, "2", http.StatusNotFound, http.StatusForbidden},
+		{"API key order", partner, "3", http.StatusOK, http.StatusForbidden},
+		{"another API key's order", partner2, "3", http.StatusNotFound, http.StatusForbidden},
+		{"API key order, customer", customer8, "3", http.StatusNotFound, http.StatusNotFound},
+		{"API key order, staff", staff, "3", http.StatusOK, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveAs(tt.principal, handler.GetOrderByID, httptest.NewRequest(http.MethodGet, "/orders/"+tt.id, nil), tt.id)
+			assert.Equal(t, tt.status, rec.Code, "GET /orders/:id")
+			if tt.status == http.StatusNotFound {
+				assert.Equal(t, "order not found", decodeError(t, rec).Message)
+			}
+
+			rec = serveAs(tt.principal, handler.GetMyOrderByID, httptest.NewRequest(http.MethodGet, "/me/orders/"+tt.id, nil), tt.id)
+			assert.Equal(t, tt.mine, rec.Code, "GET /me/orders/:id")
+		})
+	}
+}
+
+func TestCancelOrderHandler_OtherCustomer(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("GetOrderByID", 1).Return(&models.Order{ID: 1, CustomerID: null.IntFrom(7)}, nil)
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/1/cancel", strings.NewReader(`{}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := serveAs(customer8, handler.CancelOrder, req, "1")
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockRepo.AssertNotCalled(t, "CancelOrder", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCancelOrderHandler_GuestOrder(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("GetOrderByID", 2).Return(&models.Order{ID: 2}, nil)
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	for _, principal := range []*auth.Principal{nil, customer8, partner} {
+		req := httptest.NewRequest(http.MethodPost, "/orders/2/cancel", strings.NewReader(`{}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := serveAs(principal, handler.CancelOrder, req, "2")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+	mockRepo.AssertNotCalled(t, "CancelOrder", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// pageCache is an order cache holding pages of customer orders in memory.
+type pageCache struct {
+	nopOrderCache
+	pages map[int]*models.OrderPage // by customer
+	gets  []models.OrderQuery
+}
+
+func (c *pageCache) GetCustomerOrderPage(query models.OrderQuery) (*models.OrderPage, error) {
+	c.gets = append(c.gets, query)
+	if page, ok := c.pages[query.CustomerID]; ok {
+		return page, nil
+	}
+	return nil, assert.AnError
+}
+
+func (c *pageCache) SetCustomerOrderPage(query models.OrderQuery, page *models.OrderPage, _ time.Duration) error {
+	c.pages[query.CustomerID] = page
+	return nil
+}
+
+func TestListOrders_CustomerPagesAreCached(t *testing.T) {
+	cache := &pageCache{pages: map[int]*models.OrderPage{
+		7: {Items: []models.Order{{ID: 3, CustomerID: null.IntFrom(7)}}},
+	}}
+	repo := repository.NewOrderRepository(nil, cache, nopProductCache{})
+
+	page, err := repo.ListOrders(models.OrderQuery{Limit: 20, CustomerID: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Items[0].ID)
+	assert.Equal(t, []models.OrderQuery{{Limit: 20, CustomerID: 7}}, cache.gets, "pages are looked up by customer")
+}
@@ -0,0 +1,315 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/guregu/null/zero"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceOrderHandler_MergesDuplicateProducts(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	merged := []models.OrderItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 1}}
+	mockRepo.On("PlaceOrder", mock.MatchedBy(func(orderReq models.OrderRequest) bool {
+		return assert.ObjectsAreEqual(merged, orderReq.Items)
+	}), mock.Anything).Return(&models.Order{ID: 1, Items: merged}, nil)
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	body := `{"items": [{"product_id": 1, "quantity": 1}, {"product_id": 2, "quantity": 1}, {"product_id": 1, "quantity": 2}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, handler.PlaceOrder(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPlaceOrderHandler_UnknownProducts(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("PlaceOrder", mock.Anything, mock.Anything).
+		Return((*models.Order)(nil), &repository.UnknownProductsError{ProductIDs: []int{4, 9}})
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	body := `{"items": [{"product_id": 1, "quantity": 1}, {"product_id": 9, "quantity": 1}, {"product_id": 4, "quantity": 2}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	serve(c, handler.PlaceOrder)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "items[2].product_id", Message: "product with ID 4 does not exist"},
+		{Field: "items[1].product_id", Message: "product with ID 9 does not exist"},
+	}, decodeError(t, rec).Details)
+}
+
+// BenchmarkPlaceOrder places orders of growing size against a fake database that answers every
+// statement after a fixed round trip delay, and reports the number of round trips per order.
+func BenchmarkPlaceOrder(b *testing.B) {
+	for _, cartSize := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("items=%d", cartSize), func(b *testing.B) {
+			conn := &fakeConn{latency: time.Millisecond}
+			db := sql.OpenDB(conn)
+			defer db.Close()
+			repo := repository.NewOrderRepository(db, nopOrderCache{}, nopProductCache{})
+
+			orderReq := models.OrderRequest{}
+			for i := 1; i <= cartSize; i++ {
+				orderReq.Items = append(orderReq.Items, models.OrderItem{ProductID: i, Quantity: 1})
+			}
+			currency := models.CurrencyConverter{Currency: "USD", Rate: models.OneRate}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.PlaceOrder(orderReq, currency); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(conn.roundTrips.Load())/float64(b.N), "round-trips/op")
+		})
+	}
+}
+
+// recordingOrderCache records the orders cached and the customers whose pages were dropped.
+type recordingOrderCache struct {
+	nopOrderCache
+	cached      []int
+	invalidated []int
+}
+
+func (c *recordingOrderCache) SetOrderByID(id int, _ *models.Order, _ time.Duration) error {
+	c.cached = append(c.cached, id)
+	return nil
+}
+
+func (c *recordingOrderCache) InvalidateCustomerOrderPages(customerID int) error {
+	c.invalidated = append(c.invalidated, customerID)
+	return nil
+}
+
+func TestPlaceOrder_CachesOnceCommitted(t *testing.T) {
+	orderReq := models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 1}}, CustomerID: zero.IntFrom(7)}
+	currency := models.CurrencyConverter{Currency: "USD", Rate: models.OneRate}
+
+	conn := &fakeConn{}
+	cache := &recordingOrderCache{}
+	repo := repository.NewOrderRepository(sql.OpenDB(conn), cache, nopProductCache{})
+	order, err := repo.PlaceOrder(orderReq, currency)
+	require.NoError(t, err)
+	assert.Equal(t, []int{order.ID}, cache.cached)
+	assert.Equal(t, []int{7}, cache.invalidated)
+
+	conn = &fakeConn{commitErr: driver.ErrBadConn}
+	cache = &recordingOrderCache{}
+	repo = repository.NewOrderRepository(sql.OpenDB(conn), cache, nopProductCache{})
+	_, err = repo.PlaceOrder(orderReq, currency)
+	assert.Error(t, err)
+	assert.Empty(t, cache.cached, "orders that failed to commit are not cached")
+	assert.Empty(t, cache.invalidated)
+}
+
+func TestPlaceOrder_RechecksCoupon(t *testing.T) {
+	// The coupon only applies to drinks, and the product turned out to be a pizza
+	orderReq := models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 1}}, CouponCode: zero.StringFrom("DRINKS2024")}
+	currency := models.CurrencyConverter{Currency: "USD", Rate: models.OneRate}
+	conn := &fakeConn{promo: []driver.Value{"percentage", []byte("10"), int64(0), []byte("0"), int64(0), int64(0), false,
+		nil, nil, []byte("0"), []byte("{drinks}"), []byte("{}")}}
+	repo := repository.NewOrderRepository(sql.OpenDB(conn), nopOrderCache{}, nopProductCache{})
+
+	_, err := repo.PlaceOrder(orderReq, currency)
+	var notApplicable *repository.CouponNotApplicableError
+	require.ErrorAs(t, err, &notApplicable)
+	assert.Equal(t, models.CouponReasonNoEligibleItems, notApplicable.Reason)
+	assert.Zero(t, conn.redemptions.Load(), "the coupon is not redeemed")
+}
+
+func TestListOrders_ScansOrdersWithItems(t *testing.T) {
+	placed := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	order := func(id int64, createdAt driver.Value, productID driver.Value) []driver.Value {
+		row := []driver.Value{id, nil, nil, "", []byte("9.99"), []byte("0"), []byte("9.99"), []byte("0"), []byte("9.99"),
+			"USD", "pending", createdAt, ""}
+		if productID == nil {
+			return append(row, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		}
+		return append(row, productID, "Margherita", int64(1), []byte("9.99"),
+			[]byte("0"), []byte("0"), false, []byte("9.99"), []byte("0"), []byte("9.99"))
+	}
+	conn := &fakeConn{orders: [][]driver.Value{
+		order(3, placed, int64(1)),
+		order(3, placed, int64(2)),
+		order(2, nil, nil), // no created_at and no items
+		order(1, placed, int64(1)),
+	}}
+	repo := repository.NewOrderRepository(sql.OpenDB(conn), nopOrderCache{}, nopProductCache{})
+
+	page, err := repo.ListOrders(models.OrderQuery{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 3)
+	assert.Equal(t, 3, page.Items[0].ID)
+	assert.Len(t, page.Items[0].Items, 2)
+	assert.True(t, placed.Equal(page.Items[0].CreatedAt))
+	assert.Equal(t, 2, page.Items[1].ID)
+	assert.Empty(t, page.Items[1].Items)
+	assert.NotNil(t, page.Items[1].Items)
+	assert.True(t, page.Items[1].CreatedAt.IsZero())
+	assert.Equal(t, 1, page.Items[2].ID)
+	assert.Len(t, page.Items[2].Items, 1)
+}
+
+// fakeConn is a database connection answering the statements of PlaceOrder with canned rows,
+// and queries reading orders with their items with the rows in orders.
+// It serves as its own driver.Connector.
+type fakeConn struct {
+	latency     time.Duration
+	roundTrips  atomic.Int64
+	commitErr   error            // returned by Commit when set
+	orders      [][]driver.Value // rows of orders joined with their items
+	promo       []driver.Value   // row of the promo code of the order, if it has one
+	redemptions atomic.Int64     // coupon redemptions inserted
+	products    [][]driver.Value // rows of product pages
+	lastQuery   string           // last query of a product page, with its arguments
+	lastArgs    []driver.Value
+}
+
+func (c *fakeConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeConn) Driver() driver.Driver                        { return nil }
+func (c *fakeConn) Prepare(string) (driver.Stmt, error)          { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                                 { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                    { c.roundTrip(); return c, nil }
+func (c *fakeConn) Commit() error                                { c.roundTrip(); return c.commitErr }
+func (c *fakeConn) Rollback() error                              { c.roundTrip(); return nil }
+
+func (c *fakeConn) roundTrip() {
+	c.roundTrips.Add(1)
+	time.Sleep(c.latency)
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.roundTrip()
+	if strings.HasPrefix(query, "INSERT INTO coupon_redemptions") {
+		c.redemptions.Add(1)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.roundTrip()
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO orders"):
+		couponCode := args[0].Value
+		if couponCode == nil {
+			couponCode = ""
+		}
+		return &fakeRows{
+			columns: []string{"id", "customer_id", "api_key_id", "coupon_code", "currency", "status", "created_at"},
+			values:  [][]driver.Value{{int64(1), args[4].Value, args[5].Value, couponCode, "USD", "pending", time.Now()}},
+		}, nil
+	case strings.HasPrefix(query, "SELECT p.id"):
+		rows := &fakeRows{columns: []string{"id", "name", "category", "price", "native_price", "stock", "is_available"}}
+		ids := strings.Split(strings.Trim(args[0].Value.(string), "{}"), ",")
+		for _, id := range ids {
+			productID, _ := strconv.ParseInt(id, 10, 64)
+			rows.values = append(rows.values, []driver.Value{productID, "Product " + id, "pizza", []byte("9.99"), nil, nil, true})
+		}
+		return rows, nil
+	case strings.HasPrefix(query, "SELECT discount_type") && c.promo != nil:
+		return &fakeRows{columns: make([]string, len(c.promo)), values: [][]driver.Value{c.promo}}, nil
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM products"):
+		return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{int64(len(c.products))}}}, nil
+	case strings.HasPrefix(query, "SELECT id, name, price"):
+		c.lastQuery, c.lastArgs = query, nil
+		for _, arg := range args {
+			c.lastArgs = append(c.lastArgs, arg.Value)
+		}
+		return &fakeRows{columns: make([]string, 7), values: c.products}, nil
+	case strings.Contains(query, "LEFT JOIN order_items"):
+		return &fakeRows{columns: make([]string, 23), values: c.orders}, nil
+	default:
+		return &fakeRows{}, nil
+	}
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+type nopOrderCache struct{}
+
+func (nopOrderCache) GetOrderByID(int) (*models.Order, error)                        { return nil, nil }
+func (nopOrderCache) SetOrderByID(int, *models.Order, time.Duration) error           { return nil }
+func (nopOrderCache) GetIdempotencyRecord(string) (*models.IdempotencyRecord, error) { return nil, nil }
+func (nopOrderCache) SetIdempotencyRecord(string, *models.IdempotencyRecord, time.Duration) error {
+	return nil
+}
+func (nopOrderCache) GetCustomerOrderPage(models.OrderQuery) (*models.OrderPage, error) {
+	return nil, nil
+}
+func (nopOrderCache) SetCustomerOrderPage(models.OrderQuery, *models.OrderPage, time.Duration) error {
+	return nil
+}
+func (nopOrderCache) InvalidateCustomerOrderPages(int) error { return nil }
+
+type nopProductCache struct{}
+
+// missProductCache never has the page asked for.
+type missProductCache struct {
+	nopProductCache
+}
+
+func (missProductCache) GetProductPage(models.ProductQuery) (*models.ProductPage, error) {
+	return nil, errors.New("cache miss")
+}
+
+func (nopProductCache) GetProductPage(models.ProductQuery) (*models.ProductPage, error) {
+	return nil, nil
+}
+func (nopProductCache) SetProductPage(models.ProductQuery, *models.ProductPage, time.Duration) error {
+	return nil
+}
+func (nopProductCache) InvalidateProductPages() error                            { return nil }
+func (nopProductCache) GetProductByID(int) (*models.Product, error)              { return nil, nil }
+func (nopProductCache) SetProductByID(int, *models.Product, time.Duration) error { return nil }
+func (nopProductCache) DeleteProductByID(int) error                              { return nil }
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/middleware"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guregu/null"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from     models.OrderStatus
+		to       models.OrderStatus
+		expected bool
+	}{
+		{models.OrderStatusPending, models.OrderStatusConfirmed, true},
+		{models.OrderStatusPending, models.OrderStatusCancelled, true},
+		{models.OrderStatusPending, models.OrderStatusDelivered, false},
+		{models.OrderStatusConfirmed, models.OrderStatusPreparing, true},
+		{models.OrderStatusPreparing, models.OrderStatusReady, true},
+		{models.OrderStatusReady, models.OrderStatusOutForDelivery, true},
+		{models.OrderStatusOutForDelivery, models.OrderStatusCancelled, false},
+		{models.OrderStatusDelivered, models.OrderStatusRefunded, true},
+		{models.OrderStatusCancelled, models.OrderStatusConfirmed, false},
+		{models.OrderStatusRefunded, models.OrderStatusPending, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s to %s", tt.from, tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.from.CanTransitionTo(tt.to))
+		})
+	}
+}
+
+func TestUpdateOrderStatusHandler(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("UpdateOrderStatus", 7, models.OrderStatusRequest{Status: models.OrderStatusConfirmed}, mock.Anything).
+		Return(&models.Order{ID: 7, Status: models.OrderStatusConfirmed}, nil)
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPatch, "/orders/7/status", strings.NewReader(`{"status": "confirmed"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	if assert.NoError(t, handler.UpdateOrderStatus(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"confirmed"`)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateOrderStatusHandler_InvalidTransition(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("UpdateOrderStatus", 7, models.OrderStatusRequest{Status: models.OrderStatusDelivered}, mock.Anything).
+		Return((*models.Order)(nil), fmt.Errorf("%w: pending to delivered", repository.ErrInvalidStatusTransition))
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPatch, "/orders/7/status", strings.NewReader(`{"status": "delivered"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	serve(c, handler.UpdateOrderStatus)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestUpdateOrderStatusHandler_UnknownStatus(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPatch, "/orders/7/status", strings.NewReader(`{"status": "eaten"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	serve(c, handler.UpdateOrderStatus)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	mockRepo.AssertNotCalled(t, "UpdateOrderStatus", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOrderCanBeCancelledByCustomer(t *testing.T) {
+	placedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	window := 5 * time.Minute
+
+	tests := []struct {
+		name     string
+		status   models.OrderStatus
+		now      time.Time
+		expected bool
+	}{
+		{"pending long after", models.OrderStatusPending, placedAt.Add(time.Hour), true},
+		{"confirmed within window", models.OrderStatusConfirmed, placedAt.Add(4 * time.Minute), true},
+		{"confirmed after window", models.OrderStatusConfirmed, placedAt.Add(6 * time.Minute), false},
+		{"out for delivery within window", models.OrderStatusOutForDelivery, placedAt.Add(time.Minute), false},
+		{"already cancelled", models.OrderStatusCancelled, placedAt, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{Status: tt.status, CreatedAt: placedAt}
+			assert.Equal(t, tt.expected, order.CanBeCancelledByCustomer(tt.now, window))
+		})
+	}
+}
+
+func TestCancelOrderHandler_TooLate(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("GetOrderByID", 7).Return(&models.Order{ID: 7, CustomerID: null.IntFrom(7), Status: models.OrderStatusPreparing}, nil)
+	mockRepo.On("CancelOrder", 7, models.CancelOrderRequest{Reason: "changed my mind"}, mock.Anything, mock.Anything).
+		Return((*models.Order)(nil), fmt.Errorf("%w: order is preparing", repository.ErrCancellationClosed))
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/orders/7/cancel", strings.NewReader(`{"reason": " changed my mind "}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	middleware.SetPrincipal(c, customer7)
+	serve(c, handler.CancelOrder)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no longer be cancelled")
+
+	mockRepo.AssertExpectations(t)
+}
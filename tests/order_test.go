@@ -1,34 +1,44 @@
 package tests
 
 import (
+	"fmt"
+	"github.com/guregu/null"
+	"github.com/guregu/null/zero"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"order_food_online/internal/handlers"
 	"order_food_online/internal/mocks"
 	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
 	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetOrdersHandler(t *testing.T) {
 	mockRepo := new(mocks.MockOrderService)
 
 	// Mock the service behavior
-	mockRepo.On("GetAllOrders").Return([]models.Order{
-		{ID: 1, CouponCode: "test", FinalPrice: 100},
+	mockRepo.On("ListOrders", models.OrderQuery{Limit: models.DefaultPageSize}).Return(&models.OrderPage{
+		Items: []models.Order{{ID: 1, CouponCode: "test", FinalPrice: 10000}},
 	}, nil)
 
-	service := services.NewOrderService(mockRepo)
-	handler := handlers.NewOrderHandler(service, slog.Default())
+	service := services.NewOrderService(mockRepo, newCurrencyService())
+	handler := handlers.NewOrderHandler(service, nil, slog.Default())
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
 	rec := httptest.NewRecorder()
 
 	c := e.NewContext(req, rec)
+	middleware.SetPrincipal(c, &auth.Principal{Subject: "1", Roles: []string{auth.RoleKitchenStaff}})
 	if assert.NoError(t, handler.GetOrders(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
 		assert.Contains(t, rec.Body.String(), "test")
@@ -37,3 +47,150 @@ func TestGetOrdersHandler(t *testing.T) {
 	// Assert that the mock service was called
 	mockRepo.AssertExpectations(t)
 }
+
+func TestGetOrdersHandler_Filters(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+
+	// Mock the service behavior
+	mockRepo.On("ListOrders", models.OrderQuery{
+		Limit:      10,
+		From:       null.TimeFrom(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)),
+		To:         null.TimeFrom(time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)),
+		CouponCode: "PROMO123",
+	}).Return(&models.OrderPage{
+		Items:      []models.Order{{ID: 42, CouponCode: "PROMO123", FinalPrice: 1200}},
+		NextCursor: "next",
+	}, nil)
+
+	service := services.NewOrderService(mockRepo, newCurrencyService())
+	handler := handlers.NewOrderHandler(service, nil, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/orders?limit=10&from=2024-05-01&to=2024-06-01T12:30:00Z&coupon_code=PROMO123", nil)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	middleware.SetPrincipal(c, &auth.Principal{Subject: "1", Roles: []string{auth.RoleKitchenStaff}})
+	if assert.NoError(t, handler.GetOrders(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"next_cursor":"next"`)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetOrdersHandler_InvalidDateRange(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+
+	service := services.NewOrderService(mockRepo, newCurrencyService())
+	handler := handlers.NewOrderHandler(service, nil, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/orders?from=2024-06-01&to=2024-05-01", nil)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	middleware.SetPrincipal(c, &auth.Principal{Subject: "1", Roles: []string{auth.RoleKitchenStaff}})
+	serve(c, handler.GetOrders)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	mockRepo.AssertNotCalled(t, "ListOrders", mock.Anything)
+}
+
+func TestPlaceOrderHandler_CouponRedemptionLimit(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("PlaceOrder", mock.Anything, mock.Anything).
+		Return((*models.Order)(nil), fmt.Errorf("failed to redeem coupon PROMO123: %w", repository.ErrCouponRedemptionLimit))
+
+	mockCache := new(mocks.MockPromoCodeCache)
+	mockCache.On("GetPromoCode", "PROMO123").Return(&models.PromoCode{Code: "PROMO123", IsValid: true}, nil)
+
+	mockPromoCodes := new(mocks.MockPromoCodeRepository)
+	mockPromoCodes.On("GetPromoCode", "PROMO123").Return(&models.PromoCode{Code: "PROMO123", SingleUse: true}, nil)
+
+	mockProducts := new(mocks.MockProductRepository)
+	mockProducts.On("GetProductsByIDs", []int{1}).Return([]models.Product{{ID: 1, Price: 999, Category: "pizza"}}, nil)
+
+	promoCodeService := newPromoCodeService(t, mockCache, mockPromoCodes, mockProducts)
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), promoCodeService, slog.Default())
+
+	e := echo.New()
+	body := `{"coupon_code": "PROMO123", "items": [{"product_id": 1, "quantity": 1}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	serve(c, handler.PlaceOrder)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPlaceOrderHandler_IdempotentReplay(t *testing.T) {
+	// The stored fingerprint is taken once the currency defaults to the base one
+	orderReq := models.OrderRequest{
+		Items:          []models.OrderItem{{ProductID: 1, Quantity: 2}},
+		Currency:       "USD",
+		IdempotencyKey: "retry-1",
+	}
+
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("FindIdempotencyRecord", "retry-1").
+		Return(&models.IdempotencyRecord{OrderID: 7, RequestHash: orderReq.Fingerprint()}, nil)
+	mockRepo.On("GetOrderByID", 7).Return(&models.Order{ID: 7, FinalPrice: 1998}, nil)
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	body := `{"items": [{"product_id": 1, "quantity": 2}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Idempotency-Key", "retry-1")
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, handler.PlaceOrder(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+		assert.Contains(t, rec.Body.String(), `"id":7`)
+	}
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "PlaceOrder", mock.Anything, mock.Anything)
+}
+
+func TestPlaceOrderHandler_IdempotencyKeyReused(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("FindIdempotencyRecord", "retry-1").
+		Return(&models.IdempotencyRecord{OrderID: 7, RequestHash: "some-other-request"}, nil)
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	body := `{"items": [{"product_id": 1, "quantity": 2}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Idempotency-Key", "retry-1")
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	serve(c, handler.PlaceOrder)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	mockRepo.AssertNotCalled(t, "GetOrderByID", mock.Anything)
+	mockRepo.AssertNotCalled(t, "PlaceOrder", mock.Anything, mock.Anything)
+}
+
+func TestOrderRequestFingerprint(t *testing.T) {
+	a := models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 2}}, IdempotencyKey: "a"}
+	b := models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 2}}, IdempotencyKey: "b"}
+	c := models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 3}}}
+
+	assert.Equal(t, a.Fingerprint(), b.Fingerprint(), "the key itself is not part of the fingerprint")
+	assert.NotEqual(t, a.Fingerprint(), c.Fingerprint())
+
+	partner := a
+	partner.APIKeyID = zero.IntFrom(1)
+	assert.NotEqual(t, a.Fingerprint(), partner.Fingerprint(), "keys of different partners don't collide")
+}
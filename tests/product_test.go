@@ -1,29 +1,40 @@
 package tests
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"order_food_online/internal/handlers"
 	"order_food_online/internal/mocks"
 	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
 	"order_food_online/internal/services"
+	"strings"
 	"testing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetProductsHandler(t *testing.T) {
 	mockRepo := new(mocks.MockProductRepository)
 
 	// Mock the service behavior
-	mockRepo.On("GetAllProducts").Return([]models.Product{
-		{ID: 1, Name: "Mock Product 1", Price: 19.99},
-		{ID: 2, Name: "Mock Product 2", Price: 29.99},
-	}, nil)
+	mockRepo.On("ListProducts", models.ProductQuery{Limit: models.DefaultPageSize, Sort: models.ProductSortID}).
+		Return(&models.ProductPage{
+			Items: []models.Product{
+				{ID: 1, Name: "Mock Product 1", Price: 1999},
+				{ID: 2, Name: "Mock Product 2", Price: 2999},
+			},
+			Total: 2,
+		}, nil)
 
-	service := services.NewProductService(mockRepo)
+	service := services.NewProductService(mockRepo, newCurrencyService())
 	handler := handlers.NewProductHandler(service, slog.Default())
 
 	e := echo.New()
@@ -40,3 +51,224 @@ func TestGetProductsHandler(t *testing.T) {
 	// Assert that the mock service was called
 	mockRepo.AssertExpectations(t)
 }
+
+func TestGetProductsHandler_Filters(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+
+	// Mock the service behavior for a normalized query
+	mockRepo.On("ListProducts", models.ProductQuery{
+		Limit:         5,
+		Category:      "pizza",
+		MinPrice:      models.NewNullMoney(500),
+		Search:        "marg",
+		Sort:          models.ProductSortPriceDesc,
+		PriceCurrency: "USD",
+		PriceRate:     models.OneRate,
+	}).Return(&models.ProductPage{
+		Items:      []models.Product{{ID: 3, Name: "Margherita", Price: 850, Category: "pizza"}},
+		NextCursor: "next",
+		Total:      7,
+	}, nil)
+
+	service := services.NewProductService(mockRepo, newCurrencyService())
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/products?limit=5&category=Pizza&min_price=5&q=marg&sort=-price", nil)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, handler.GetProducts(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"next_cursor":"next"`)
+		assert.Contains(t, rec.Body.String(), `"total":7`)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetProductsHandler_InvalidSort(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+
+	service := services.NewProductService(mockRepo, newCurrencyService())
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/products?sort=category", nil)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	serve(c, handler.GetProducts)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	mockRepo.AssertNotCalled(t, "ListProducts", mock.Anything)
+}
+
+func TestCreateProductHandler_InvalidPrice(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+
+	service := services.NewProductService(mockRepo, newCurrencyService())
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	e := echo.New()
+	body := `{"name": "Margherita", "price": -4.5, "category": "pizza"}`
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	serve(c, handler.CreateProduct)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "price")
+
+	mockRepo.AssertNotCalled(t, "CreateProduct", mock.Anything)
+}
+
+func TestImportProductsHandler_CSV(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+
+	// Expect normalized products
+	mockRepo.On("ImportProducts", []models.ProductRequest{
+		{Name: "Margherita", Price: 850, Category: "pizza"},
+		{Name: "Lemonade", Price: 299, Category: "drinks"},
+	}).Return([]models.Product{
+		{ID: 10, Name: "Margherita", Price: 850, Category: "pizza"},
+		{ID: 11, Name: "Lemonade", Price: 299, Category: "drinks"},
+	}, nil)
+
+	service := services.NewProductService(mockRepo, newCurrencyService())
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	e := echo.New()
+	body := "category,name,price\nPizza, Margherita ,8.50\ndrinks,Lemonade,2.99\n"
+	req := httptest.NewRequest(http.MethodPost, "/products/import", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, handler.ImportProducts(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Lemonade")
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+// endlessReader repeats its text forever, as a client streaming an unbounded body would.
+type endlessReader struct {
+	text   string
+	offset int
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.text[r.offset:])
+		n += copied
+		r.offset = (r.offset + copied) % len(r.text)
+	}
+	return n, nil
+}
+
+func TestImportProductsHandler_Limits(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+	service := services.NewProductService(mockRepo, newCurrencyService())
+	handler := handlers.NewProductHandler(service, slog.Default())
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        io.Reader
+		status      int
+	}{
+		{
+			name:        "JSON past the product limit",
+			contentType: echo.MIMEApplicationJSON,
+			body:        io.MultiReader(strings.NewReader("["), &endlessReader{text: `{"name": "Margherita", "price": 8.5, "category": "pizza"},`}),
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "CSV past the product limit",
+			contentType: "text/csv",
+			body:        io.MultiReader(strings.NewReader("name,price,category\n"), &endlessReader{text: "Margherita,8.50,pizza\n"}),
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "body past the size limit",
+			contentType: echo.MIMEApplicationJSON,
+			body:        io.MultiReader(strings.NewReader(`[{"name": "`), &endlessReader{text: "a"}),
+			status:      http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The bodies never end: the import must stop reading them by itself
+			req := httptest.NewRequest(http.MethodPost, "/products/import", tt.body)
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+			serve(echo.New().NewContext(req, rec), handler.ImportProducts)
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+	mockRepo.AssertNotCalled(t, "ImportProducts", mock.Anything)
+}
+
+func TestListProducts_SortsByPriceInCurrency(t *testing.T) {
+	// In USD the pasta (8.00) is cheaper than the pizza (10.00), but the pizza has a native
+	// price of 5.00 EUR while the pasta costs 7.36 EUR once converted
+	conn := &fakeConn{products: [][]driver.Value{
+		{int64(2), "Pizza", []byte("10.00"), "pizza", []byte(`{"EUR": 5.00}`), nil, true},
+		{int64(1), "Pasta", []byte("8.00"), "pasta", nil, nil, true},
+	}}
+	repo := repository.NewProductRepository(sql.OpenDB(conn), missProductCache{})
+	service := services.NewProductService(repo, newCurrencyService(models.ExchangeRate{Currency: "EUR", Rate: 920000}))
+
+	query := models.ProductQuery{Limit: 1, Sort: models.ProductSortPrice, Currency: "EUR"}
+	page, err := service.ListProducts(query)
+	require.NoError(t, err)
+	assert.Contains(t, conn.lastQuery, "ORDER BY COALESCE(")
+	assert.Equal(t, []driver.Value{"EUR", "0.920000"}, conn.lastArgs)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, models.Money(500), page.Items[0].Price)
+
+	// The cursor holds the price the page was sorted on
+	var cursor models.ProductCursor
+	require.NoError(t, models.DecodeCursor(page.NextCursor, &cursor))
+	assert.Equal(t, models.ProductCursor{Sort: models.ProductSortPrice, ID: 2, Name: "Pizza", Price: 500, Currency: "EUR"}, cursor)
+
+	query.Cursor = page.NextCursor
+	_, err = service.ListProducts(query)
+	require.NoError(t, err)
+	assert.Contains(t, conn.lastQuery, "ROUND(price * $2, 2)), id) > ($3, $4)")
+	assert.Equal(t, []driver.Value{"EUR", "0.920000", "5.00", int64(2)}, conn.lastArgs)
+
+	// Cursors of a page sorted in another currency are rejected
+	query.Currency = ""
+	_, err = service.ListProducts(query)
+	assert.ErrorIs(t, err, models.ErrInvalidCursor)
+}
+
+func TestListProducts_FiltersWithoutRate(t *testing.T) {
+	conn := &fakeConn{products: [][]driver.Value{
+		{int64(2), "Pizza", []byte("10.00"), "pizza", []byte(`{"GBP": 8.50}`), nil, true},
+		{int64(1), "Pasta", []byte("8.00"), "pasta", nil, nil, true},
+	}}
+	repo := repository.NewProductRepository(sql.OpenDB(conn), missProductCache{})
+	service := services.NewProductService(repo, newCurrencyService())
+
+	// GBP has no rate: the pasta has no GBP price, so it can't be left out by the filter and
+	// pricing it fails
+	query := models.ProductQuery{Limit: 10, MaxPrice: models.NewNullMoney(500), Sort: models.ProductSortID, Currency: "GBP"}
+	_, err := service.ListProducts(query)
+	assert.ErrorIs(t, err, models.ErrUnsupportedCurrency)
+	assert.Contains(t, conn.lastQuery, "ROUND(price * $2, 2)) <= $3 OR COALESCE(")
+	assert.Equal(t, []driver.Value{"GBP", nil, "5.00"}, conn.lastArgs)
+
+	// Products that all have a GBP price are listed at it
+	conn.products = conn.products[:1]
+	page, err := service.ListProducts(query)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, models.Money(850), page.Items[0].Price)
+}
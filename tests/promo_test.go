@@ -1,17 +1,47 @@
 package tests
 
 import (
+	"github.com/guregu/null"
+	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
 	"order_food_online/internal/mocks"
 	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
 	"order_food_online/internal/services"
-	"order_food_online/pkg/helpers"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
+// newCouponRepository loads bases where PROMO123 is in the first two bases, but PROMO456
+// only in the third one.
+func newCouponRepository(t *testing.T) repository.CouponRepository {
+	dir := t.TempDir()
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase1.gz"), "PROMO123")
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase2.gz"), "PROMO123")
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase3.gz"), "PROMO456")
+	coupons, err := repository.NewCouponRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return coupons
+}
+
+func newPromoCodeService(
+	t *testing.T,
+	cache *mocks.MockPromoCodeCache,
+	promoCodes *mocks.MockPromoCodeRepository,
+	products *mocks.MockProductRepository,
+) *services.PromoCodeService {
+	return services.NewPromoCodeService(cache, newCouponRepository(t), promoCodes, products, newCurrencyService(), slog.Default())
+}
+
 func TestValidatePromo(t *testing.T) {
-	helpers.LoadEnv()
 	mockCache := new(mocks.MockPromoCodeCache)
 
 	// Mock cache miss for GetPromoCode
@@ -20,13 +50,17 @@ func TestValidatePromo(t *testing.T) {
 	// Mock cache update for SetPromoCode
 	mockCache.On("SetPromoCode", "PROMO123", mock.Anything, mock.Anything).Return(nil)
 
-	service := services.NewPromoCodeService(mockCache)
+	// Mock a code without discount rule
+	mockPromoCodes := new(mocks.MockPromoCodeRepository)
+	mockPromoCodes.On("GetPromoCode", "PROMO123").Return(nil, nil)
+
+	service := newPromoCodeService(t, mockCache, mockPromoCodes, new(mocks.MockProductRepository))
 
-	// Assuming PROMO123 isn't valid in this test case
-	isValid, err := service.ValidatePromo("PROMO123")
+	// PROMO123 appears in couponbase1 and couponbase2
+	quote, err := service.ValidatePromo("PROMO123", nil, "")
 
 	assert.NoError(t, err)
-	assert.True(t, isValid)
+	assert.True(t, quote.Valid)
 
 	// Validate cache interactions
 	mockCache.AssertCalled(t, "GetPromoCode", "PROMO123")
@@ -41,12 +75,15 @@ func TestValidatePromo_WithCacheHit(t *testing.T) {
 		IsValid: true,
 	}, nil)
 
-	service := services.NewPromoCodeService(mockCache)
+	mockPromoCodes := new(mocks.MockPromoCodeRepository)
+	mockPromoCodes.On("GetPromoCode", "PROMO123").Return(nil, nil)
 
-	isValid, err := service.ValidatePromo("PROMO123")
+	service := newPromoCodeService(t, mockCache, mockPromoCodes, new(mocks.MockProductRepository))
+
+	quote, err := service.ValidatePromo("PROMO123", nil, "")
 
 	assert.NoError(t, err)
-	assert.True(t, isValid)
+	assert.True(t, quote.Valid)
 
 	// Validate that cache methods were called as expected
 	mockCache.AssertCalled(t, "GetPromoCode", "PROMO123")
@@ -57,20 +94,113 @@ func TestValidatePromo_WithCacheMiss(t *testing.T) {
 	mockCache := new(mocks.MockPromoCodeCache)
 
 	// Mock cache miss for GetPromoCode
-	mockCache.On("GetPromoCode", "PROMO123").Return(nil, nil)
+	mockCache.On("GetPromoCode", "PROMO456").Return(nil, nil)
 
 	// Mock cache update for SetPromoCode
-	mockCache.On("SetPromoCode", "PROMO123", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("SetPromoCode", "PROMO456", mock.Anything, mock.Anything).Return(nil)
 
-	service := services.NewPromoCodeService(mockCache)
+	service := newPromoCodeService(t, mockCache, new(mocks.MockPromoCodeRepository), new(mocks.MockProductRepository))
 
-	// Assuming PROMO123 isn't valid in this test case
-	isValid, err := service.ValidatePromo("PROMO123")
+	// PROMO456 only appears in couponbase3
+	quote, err := service.ValidatePromo("PROMO456", nil, "")
 
 	assert.NoError(t, err)
-	assert.False(t, isValid)
+	assert.False(t, quote.Valid)
+	assert.Equal(t, models.CouponReasonUnknownCode, quote.Reason)
 
 	// Validate cache interactions
-	mockCache.AssertCalled(t, "GetPromoCode", "PROMO123")
-	mockCache.AssertCalled(t, "SetPromoCode", "PROMO123", mock.Anything, mock.Anything)
+	mockCache.AssertCalled(t, "GetPromoCode", "PROMO456")
+	mockCache.AssertCalled(t, "SetPromoCode", "PROMO456", mock.Anything, mock.Anything)
+}
+
+func TestValidatePromo_WithDiscount(t *testing.T) {
+	mockCache := new(mocks.MockPromoCodeCache)
+	mockCache.On("GetPromoCode", "PROMO123").Return(nil, nil)
+	mockCache.On("SetPromoCode", "PROMO123", mock.Anything, mock.Anything).Return(nil)
+
+	mockPromoCodes := new(mocks.MockPromoCodeRepository)
+	mockPromoCodes.On("GetPromoCode", "PROMO123").Return(&models.PromoCode{
+		Code:          "PROMO123",
+		DiscountType:  models.DiscountPercentage,
+		DiscountValue: 2000,
+	}, nil)
+
+	mockProducts := new(mocks.MockProductRepository)
+	mockProducts.On("GetProductsByIDs", []int{1}).Return([]models.Product{{ID: 1, Price: 1250, Category: "pizza"}}, nil)
+
+	service := newPromoCodeService(t, mockCache, mockPromoCodes, mockProducts)
+
+	quote, err := service.ValidatePromo("PROMO123", []models.OrderItem{{ProductID: 1, Quantity: 2}}, "")
+
+	assert.NoError(t, err)
+	assert.True(t, quote.Valid)
+	assert.Equal(t, models.Money(2500), quote.Subtotal)
+	assert.Equal(t, models.Money(500), quote.Discount)
+	assert.Equal(t, models.Money(2000), quote.FinalPrice)
+}
+
+func TestValidatePromo_Expired(t *testing.T) {
+	mockCache := new(mocks.MockPromoCodeCache)
+	mockCache.On("GetPromoCode", "PROMO123").Return(&models.PromoCode{Code: "PROMO123", IsValid: true}, nil)
+
+	mockPromoCodes := new(mocks.MockPromoCodeRepository)
+	mockPromoCodes.On("GetPromoCode", "PROMO123").Return(&models.PromoCode{
+		Code:          "PROMO123",
+		DiscountType:  models.DiscountFixed,
+		DiscountValue: 500,
+		EndsAt:        null.TimeFrom(time.Now().Add(-time.Hour)),
+	}, nil)
+
+	mockProducts := new(mocks.MockProductRepository)
+	mockProducts.On("GetProductsByIDs", []int{1}).Return([]models.Product{{ID: 1, Price: 1250, Category: "pizza"}}, nil)
+
+	service := newPromoCodeService(t, mockCache, mockPromoCodes, mockProducts)
+
+	quote, err := service.ValidatePromo("PROMO123", []models.OrderItem{{ProductID: 1, Quantity: 1}}, "")
+
+	assert.NoError(t, err)
+	assert.False(t, quote.Valid)
+	assert.Equal(t, models.CouponReasonExpired, quote.Reason)
+	assert.Equal(t, models.Money(1250), quote.FinalPrice)
+}
+
+func TestValidateCouponHandler_InvalidItems(t *testing.T) {
+	mockProducts := new(mocks.MockProductRepository)
+	service := newPromoCodeService(t, new(mocks.MockPromoCodeCache), new(mocks.MockPromoCodeRepository), mockProducts)
+	handler := handlers.NewPromoCodeHandler(service, slog.Default())
+
+	// Quantities are checked as for orders, so a quote never gets a negative discount
+	req, rec := postJSON("/coupons/validate", `{"code": "PROMO123", "items": [{"product_id": 1, "quantity": 0}, {"product_id": 2, "quantity": -3}]}`)
+	serve(echo.New().NewContext(req, rec), handler.ValidateCoupon)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	apiErr := decodeError(t, rec)
+	assert.Equal(t, handlers.CodeValidationFailed, apiErr.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "items[0].quantity", Message: "must be between 1 and 100"},
+		{Field: "items[1].quantity", Message: "must be between 1 and 100"},
+	}, apiErr.Details)
+	mockProducts.AssertNotCalled(t, "GetProductsByIDs", mock.Anything)
+}
+
+func TestGetCouponStatusHandler_HidesDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase1.gz"), "PROMO123")
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase2.gz"), "PROMO123")
+	writeGzipCouponBase(t, filepath.Join(dir, "couponbase3.gz"), "PROMO456")
+	coupons, err := repository.NewCouponRepository(dir)
+	assert.NoError(t, err)
+	service := services.NewPromoCodeService(new(mocks.MockPromoCodeCache), coupons, new(mocks.MockPromoCodeRepository),
+		new(mocks.MockProductRepository), newCurrencyService(), slog.Default())
+	handler := handlers.NewPromoCodeHandler(service, slog.Default())
+
+	// The status is public, so it must not tell where the server keeps the bases
+	req := httptest.NewRequest(http.MethodGet, "/coupons/status", nil)
+	rec := httptest.NewRecorder()
+	serve(echo.New().NewContext(req, rec), handler.GetCouponStatus)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), dir)
+	assert.NotContains(t, rec.Body.String(), `"dir"`)
+	assert.Contains(t, rec.Body.String(), `"couponbase1.gz"`)
 }
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/services"
+	"order_food_online/pkg/auth"
+	"order_food_online/pkg/middleware"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPrincipalCan(t *testing.T) {
+	permissions := auth.Permissions
+	tests := []struct {
+		role    string
+		granted []auth.Permission
+	}{
+		{auth.RoleCustomer, []auth.Permission{auth.PermPlaceOrders}},
+		{auth.RoleKitchenStaff, []auth.Permission{auth.PermPlaceOrders, auth.PermReadAllOrders, auth.PermUpdateOrderStatus}},
+		{auth.RoleRestaurantAdmin, []auth.Permission{auth.PermPlaceOrders, auth.PermReadAllOrders, auth.PermUpdateOrderStatus, auth.PermManageCatalog}},
+		{auth.RolePlatformAdmin, permissions},
+		{"admin", permissions},
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			principal := &auth.Principal{Subject: "1", Roles: []string{tt.role}}
+			for _, permission := range permissions {
+				assert.Equal(t, contains(tt.granted, permission), principal.Can(permission), permission)
+			}
+		})
+	}
+}
+
+func TestPrincipalCan_Scopes(t *testing.T) {
+	token := &auth.Principal{Subject: "ada@example.com", Roles: []string{auth.RoleCustomer}, Scopes: []string{string(auth.PermManageCatalog)}}
+	assert.False(t, token.Can(auth.PermManageCatalog), "token scopes grant nothing")
+	assert.True(t, token.Can(auth.PermPlaceOrders))
+
+	key := &auth.Principal{Subject: "api_key:1", Scopes: []string{string(auth.PermManageCatalog)}, APIKeyID: 1}
+	assert.True(t, key.Can(auth.PermManageCatalog))
+	assert.False(t, key.Can(auth.PermPlaceOrders))
+}
+
+func contains(permissions []auth.Permission, permission auth.Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRequirePermission(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: testJWTSecret})
+	assert.NoError(t, err)
+	e := echo.New()
+	e.PUT("/products/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) },
+		middleware.RequirePermission(auth.PermManageCatalog))
+	e.Use(middleware.AuthMiddleware(verifier, []string{"/products/:id"}))
+
+	assert.Equal(t, http.StatusUnauthorized, request(e, http.MethodPut, "/products/1", "").Code)
+
+	for role, status := range map[string]int{
+		auth.RoleCustomer:        http.StatusForbidden,
+		auth.RoleKitchenStaff:    http.StatusForbidden,
+		auth.RoleRestaurantAdmin: http.StatusNoContent,
+		auth.RolePlatformAdmin:   http.StatusNoContent,
+	} {
+		claims := validClaims()
+		claims["roles"] = []string{role}
+		rec := request(e, http.MethodPut, "/products/1", signHS256(t, claims))
+		assert.Equal(t, status, rec.Code, role)
+		if status == http.StatusForbidden {
+			assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), `error="insufficient_scope"`)
+		}
+	}
+
+	claims := validClaims()
+	claims["scope"] = string(auth.PermManageCatalog)
+	assert.Equal(t, http.StatusForbidden, request(e, http.MethodPut, "/products/1", signHS256(t, claims)).Code,
+		"the scopes of a token grant no permission")
+}
+
+func TestGetOrdersHandler_CustomerSeesOwnOrders(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("ListOrders", models.OrderQuery{Limit: models.DefaultPageSize, CustomerID: 7}).
+		Return(&models.OrderPage{Items: []models.Order{}}, nil).Once()
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		status    int
+	}{
+		{"customer", customer7, http.StatusOK},
+		{"external customer", &auth.Principal{Subject: "ada@example.com"}, http.StatusForbidden},
+		{"anonymous", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/orders", nil), rec)
+			if tt.principal != nil {
+				middleware.SetPrincipal(c, tt.principal)
+			}
+			serve(c, handler.GetOrders)
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSetUserRoleHandler(t *testing.T) {
+	users := new(mocks.MockUserRepository)
+	users.On("SetUserRole", 7, auth.RoleKitchenStaff).Return(&models.User{ID: 7, Role: auth.RoleKitchenStaff}, nil)
+	handler := newAuthHandler(t, users, new(mocks.MockRefreshTokenRepository))
+
+	req, rec := postJSON("/users/7/role", `{"role":"kitchen_staff"}`)
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	serve(c, handler.SetUserRole)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"role":"kitchen_staff"`)
+
+	req, rec = postJSON("/users/7/role", `{"role":"chef"}`)
+	c = echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	serve(c, handler.SetUserRole)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "role", decodeError(t, rec).Details[0].Field)
+	users.AssertNumberOfCalls(t, "SetUserRole", 1)
+	users.AssertNotCalled(t, "SetUserRole", mock.Anything, "chef")
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"strings"
+	"testing"
+
+	"github.com/guregu/null"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPlaceOrderHandler_OutOfStock(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+	mockRepo.On("PlaceOrder", mock.Anything, mock.Anything).
+		Return((*models.Order)(nil), fmt.Errorf("failed to place order: %w", &repository.OutOfStockError{ProductID: 3, ProductName: "Tiramisu"}))
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	body := `{"items": [{"product_id": 3, "quantity": 5}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	serve(c, handler.PlaceOrder)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Tiramisu is out of stock")
+	assert.Contains(t, rec.Body.String(), `"code":"out_of_stock"`)
+	assert.Contains(t, rec.Body.String(), `"field":"items[0].product_id"`)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSetStockHandler(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+	mockRepo.On("SetStock", 3, models.StockRequest{Stock: null.IntFrom(12), Available: null.BoolFrom(true)}).
+		Return(&models.Product{ID: 3, Name: "Tiramisu", Price: 550, Stock: null.IntFrom(12), Available: true}, nil)
+
+	handler := handlers.NewProductHandler(services.NewProductService(mockRepo, newCurrencyService()), slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/products/3/stock", strings.NewReader(`{"stock": 12}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	if assert.NoError(t, handler.SetStock(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"stock":12`)
+		assert.Contains(t, rec.Body.String(), `"available":true`)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSetStockHandler_Negative(t *testing.T) {
+	mockRepo := new(mocks.MockProductRepository)
+
+	handler := handlers.NewProductHandler(services.NewProductService(mockRepo, newCurrencyService()), slog.Default())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/products/3/stock", strings.NewReader(`{"stock": -1}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	serve(c, handler.SetStock)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	mockRepo.AssertNotCalled(t, "SetStock", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"order_food_online/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyTaxes(t *testing.T) {
+	rules := models.NewTaxRules([]models.TaxRule{
+		{Category: "pizza", Rate: 1000, Inclusive: true}, // 10% included in the price
+		{Category: "drinks", Rate: 2000},                 // 20% on top of the price
+		{Category: models.DefaultTaxCategory, Rate: 550},
+	})
+	categories := map[int]string{1: "pizza", 2: "drinks", 3: "desserts"}
+
+	items := []models.OrderItem{
+		{ProductID: 1, Quantity: 2, Price: 1100},
+		{ProductID: 2, Quantity: 1, Price: 250},
+		{ProductID: 3, Quantity: 1, Price: 400},
+	}
+	models.ApplyTaxes(items, categories, rules)
+
+	assert.Equal(t, models.OrderItem{ProductID: 1, Quantity: 2, Price: 1100, TaxRate: 1000, TaxInclusive: true, Net: 2000, Tax: 200, Gross: 2200}, items[0])
+	assert.Equal(t, models.OrderItem{ProductID: 2, Quantity: 1, Price: 250, TaxRate: 2000, Net: 250, Tax: 50, Gross: 300}, items[1])
+	assert.Equal(t, models.OrderItem{ProductID: 3, Quantity: 1, Price: 400, TaxRate: 550, Net: 400, Tax: 22, Gross: 422}, items[2])
+
+	order := models.Order{Items: items}
+	order.SetTotals()
+	assert.Equal(t, models.Money(2650), order.Net)
+	assert.Equal(t, models.Money(272), order.Tax)
+	assert.Equal(t, models.Money(2922), order.FinalPrice)
+	assert.Equal(t, []models.TaxSummary{
+		{Rate: 550, Net: 400, Tax: 22, Gross: 422},
+		{Rate: 1000, Net: 2000, Tax: 200, Gross: 2200},
+		{Rate: 2000, Net: 250, Tax: 50, Gross: 300},
+	}, order.Taxes)
+}
+
+func TestApplyTaxes_NoRule(t *testing.T) {
+	items := []models.OrderItem{{ProductID: 1, Quantity: 3, Price: 333}}
+	models.ApplyTaxes(items, map[int]string{1: "pizza"}, models.TaxRules{})
+
+	assert.Equal(t, models.Money(999), items[0].Net)
+	assert.Equal(t, models.Money(0), items[0].Tax)
+	assert.Equal(t, models.Money(999), items[0].Gross)
+}
+
+func TestPromoCodeAllocateDiscount(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: 1, Quantity: 1, Price: 1000},
+		{ProductID: 2, Quantity: 2, Price: 1000},
+		{ProductID: 3, Quantity: 1, Price: 500},
+	}
+	categories := map[int]string{1: "pizza", 2: "pizza", 3: "drinks"}
+
+	// Only pizzas are discounted, in proportion to their amount, and the cents add up
+	promo := models.PromoCode{DiscountType: models.DiscountFixed, DiscountValue: 100, AllowedCategories: []string{"pizza"}}
+	promo.AllocateDiscount(items, categories, 100)
+	assert.Equal(t, models.Money(33), items[0].Discount)
+	assert.Equal(t, models.Money(67), items[1].Discount)
+	assert.Equal(t, models.Money(0), items[2].Discount)
+
+	// A free item is taken off its own line
+	promo = models.PromoCode{DiscountType: models.DiscountFreeItem, FreeProductID: 3}
+	promo.AllocateDiscount(items, categories, 500)
+	assert.Equal(t, models.Money(0), items[0].Discount)
+	assert.Equal(t, models.Money(0), items[1].Discount)
+	assert.Equal(t, models.Money(500), items[2].Discount)
+}
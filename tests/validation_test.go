@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order_food_online/internal/handlers"
+	"order_food_online/internal/mocks"
+	"order_food_online/internal/models"
+	"order_food_online/internal/repository"
+	"order_food_online/internal/services"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// serve runs a handler the way the server does, writing the error it returns with the API error handler.
+func serve(c echo.Context, h echo.HandlerFunc) {
+	if err := h(c); err != nil {
+		handlers.NewHTTPErrorHandler(slog.Default())(err, c)
+	}
+}
+
+// decodeError reads the error envelope of a response.
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) handlers.ErrorResponse {
+	var body handlers.ErrorBody
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return body.Error
+}
+
+func TestOrderRequestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    models.OrderRequest
+		fields []string
+	}{
+		{"valid", models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 1}}}, nil},
+		{"no items", models.OrderRequest{}, []string{"items"}},
+		{"zero quantity", models.OrderRequest{Items: []models.OrderItem{{ProductID: 1}}}, []string{"items[0].quantity"}},
+		{"negative quantity", models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: -3}}}, []string{"items[0].quantity"}},
+		{"absurd quantity", models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 100000}}}, []string{"items[0].quantity"}},
+		{"unknown product", models.OrderRequest{Items: []models.OrderItem{{Quantity: 1}}}, []string{"items[0].product_id"}},
+		{"duplicate product", models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 1}, {ProductID: 1, Quantity: 3}}}, nil},
+		{
+			"duplicate product over the limit",
+			models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 60}, {ProductID: 1, Quantity: 0}, {ProductID: 1, Quantity: 60}, {ProductID: 1, Quantity: 1}}},
+			[]string{"items[1].quantity", "items[2].quantity"},
+		},
+		{"bad currency", models.OrderRequest{Items: []models.OrderItem{{ProductID: 1, Quantity: 1}}, Currency: "EURO"}, []string{"currency"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.fields == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var fieldErrs models.ValidationErrors
+			if assert.True(t, errors.As(err, &fieldErrs)) {
+				fields := make([]string, len(fieldErrs))
+				for i, fieldErr := range fieldErrs {
+					fields[i] = fieldErr.Field
+				}
+				assert.Equal(t, tt.fields, fields)
+			}
+			assert.ErrorIs(t, err, models.ErrValidation)
+		})
+	}
+}
+
+func TestOrderRequestValidate_TooManyItems(t *testing.T) {
+	req := models.OrderRequest{}
+	for i := 1; i <= models.MaxOrderItems+1; i++ {
+		req.Items = append(req.Items, models.OrderItem{ProductID: i, Quantity: 1})
+	}
+	assert.ErrorIs(t, req.Validate(), models.ErrValidation)
+}
+
+func TestOrderRequestMergeItems(t *testing.T) {
+	req := models.OrderRequest{Items: []models.OrderItem{
+		{ProductID: 2, Quantity: 1},
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 3},
+		{ProductID: 1, Quantity: 1},
+	}}
+	req.MergeItems()
+	assert.Equal(t, []models.OrderItem{{ProductID: 2, Quantity: 4}, {ProductID: 1, Quantity: 3}}, req.Items)
+}
+
+func TestPlaceOrderHandler_InvalidItems(t *testing.T) {
+	mockRepo := new(mocks.MockOrderService)
+
+	handler := handlers.NewOrderHandler(services.NewOrderService(mockRepo, newCurrencyService()), nil, slog.Default())
+
+	e := echo.New()
+	body := `{"items": [{"product_id": 2, "quantity": 0}, {"product_id": 1, "quantity": 60}, {"product_id": 1, "quantity": 60}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	serve(c, handler.PlaceOrder)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	apiErr := decodeError(t, rec)
+	assert.Equal(t, handlers.CodeValidationFailed, apiErr.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "items[0].quantity", Message: "must be between 1 and 100"},
+		{Field: "items[2].quantity", Message: "must add up to at most 100 with the other lines for product 1"},
+	}, apiErr.Details)
+
+	mockRepo.AssertNotCalled(t, "PlaceOrder", mock.Anything, mock.Anything)
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		msg    string
+	}{
+		{"echo error", echo.NewHTTPError(http.StatusUnauthorized, "missing authorization header"), http.StatusUnauthorized, handlers.CodeUnauthorized, "missing authorization header"},
+		{"route not found", echo.ErrNotFound, http.StatusNotFound, handlers.CodeNotFound, "Not Found"},
+		{"domain error", fmt.Errorf("failed to place order: %w", services.ErrIdempotencyKeyReused), http.StatusUnprocessableEntity, handlers.CodeIdempotencyKeyReused, services.ErrIdempotencyKeyReused.Error()},
+		{"domain error details", fmt.Errorf("failed to update order: %w", fmt.Errorf("%w: delivered to pending", repository.ErrInvalidStatusTransition)), http.StatusConflict, handlers.CodeConflict, "invalid order status transition: delivered to pending"},
+		{"validation errors", fmt.Errorf("failed to save: %w", models.ValidationErrors{{Field: "name", Message: "is required"}}), http.StatusBadRequest, handlers.CodeValidationFailed, "request is invalid"},
+		{"unexpected error", errors.New("connection refused"), http.StatusInternalServerError, handlers.CodeInternal, "internal server error"},
+		// Handlers report missing resources themselves: a lookup failing deep down is not a 404
+		{"unexpected no rows", fmt.Errorf("failed to fetch tax rules: %w", sql.ErrNoRows), http.StatusInternalServerError, handlers.CodeInternal, "internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+			handlers.NewHTTPErrorHandler(slog.Default())(tt.err, c)
+			assert.Equal(t, tt.status, rec.Code)
+			apiErr := decodeError(t, rec)
+			assert.Equal(t, tt.code, apiErr.Code)
+			assert.Equal(t, tt.msg, apiErr.Message)
+		})
+	}
+}